@@ -0,0 +1,168 @@
+package ctxutil
+
+import (
+	"context"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Defaults for the zero fields of AdaptiveOptions.
+const (
+	DefaultAdaptiveQuantile   = 0.99
+	DefaultAdaptiveMultiplier = 2
+	DefaultAdaptiveMinSamples = 100
+	DefaultAdaptiveWindow     = 10000
+)
+
+// AdaptiveOptions configures an AdaptiveTimeout.
+type AdaptiveOptions struct {
+	Quantile   float64       // latency quantile to track, DefaultAdaptiveQuantile if zero
+	Multiplier float64       // factor applied to the quantile, DefaultAdaptiveMultiplier if zero
+	Min        time.Duration // lower bound of the timeout
+	Max        time.Duration // upper bound of the timeout, none if zero
+
+	// Initial is the timeout until MinSamples latencies have been observed.
+	// If zero, Max is used; if both are zero, there is no timeout until then.
+	Initial    time.Duration
+	MinSamples int // DefaultAdaptiveMinSamples if zero
+
+	// Window is roughly how many recent latencies the quantile reflects:
+	// once that many are recorded, older ones are given half the weight.
+	// DefaultAdaptiveWindow if zero.
+	Window int
+}
+
+// Latencies are recorded in a log-linear histogram, like HDR histograms:
+// each power of two is split into subBuckets linear buckets, which bounds
+// the relative error of a quantile to 1/subBuckets.
+const (
+	subBucketBits = 3
+	subBuckets    = 1 << subBucketBits
+	numBuckets    = (64 - subBucketBits + 1) * subBuckets
+)
+
+// AdaptiveTimeout derives timeouts for an operation, such as a database
+// query, from the latencies observed for it: the timeout is a high quantile
+// of the recent latencies times a multiplier, clamped to [Min, Max].
+// Keep a single AdaptiveTimeout per operation, typically in a package
+// variable, so that it observes all of the operation's latencies.
+// It's safe for concurrent use.
+type AdaptiveTimeout struct {
+	operation string
+	opts      AdaptiveOptions
+
+	mu     sync.Mutex
+	counts [numBuckets]uint64
+	total  uint64
+}
+
+// NewAdaptiveTimeout creates an AdaptiveTimeout for the named operation.
+func NewAdaptiveTimeout(operation string, opts AdaptiveOptions) *AdaptiveTimeout {
+	if opts.Quantile <= 0 || opts.Quantile > 1 {
+		opts.Quantile = DefaultAdaptiveQuantile
+	}
+	if opts.Multiplier <= 0 {
+		opts.Multiplier = DefaultAdaptiveMultiplier
+	}
+	if opts.Initial <= 0 {
+		opts.Initial = opts.Max
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = DefaultAdaptiveMinSamples
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultAdaptiveWindow
+	}
+	return &AdaptiveTimeout{operation: operation, opts: opts}
+}
+
+// Operation returns the name of the operation.
+func (a *AdaptiveTimeout) Operation() string {
+	return a.operation
+}
+
+// Observe records the latency of a completed operation.
+func (a *AdaptiveTimeout) Observe(latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.counts[bucketOf(uint64(max(latency, 0)))]++
+	a.total++
+
+	if a.total >= uint64(a.opts.Window) {
+		a.total = 0
+		for i, c := range a.counts {
+			a.counts[i] = c / 2
+			a.total += c / 2
+		}
+	}
+}
+
+// Timeout returns the current timeout, or zero if there is none.
+func (a *AdaptiveTimeout) Timeout() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.total < uint64(a.opts.MinSamples) {
+		return a.opts.Initial
+	}
+
+	timeout := time.Duration(math.Min(float64(a.quantile())*a.opts.Multiplier, math.MaxInt64))
+	timeout = max(timeout, a.opts.Min)
+	if a.opts.Max > 0 {
+		timeout = min(timeout, a.opts.Max)
+	}
+	return timeout
+}
+
+// Derive creates a fresh context with the current timeout, like ExtendTimeout.
+// Its deadline is labeled with the operation name unless another label is
+// set with WithLabel, see ExplainDeadline.
+// While there is no timeout, the context has no deadline.
+func (a *AdaptiveTimeout) Derive(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+	timeout := a.Timeout()
+	if timeout <= 0 {
+		newCtx, cancel := context.WithCancel(detach(ctx))
+		return newCtx, track("AdaptiveTimeout", cancel)
+	}
+
+	o := options{label: a.operation}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return withDeadline(detach(ctx), clockFrom(ctx).Now().Add(timeout), "AdaptiveTimeout", o)
+}
+
+// quantile returns the upper bound of the bucket holding the quantile.
+func (a *AdaptiveTimeout) quantile() time.Duration {
+	rank := uint64(math.Ceil(a.opts.Quantile * float64(a.total)))
+	var seen uint64
+	for i, c := range a.counts {
+		seen += c
+		if seen >= rank && c > 0 {
+			return time.Duration(bucketUpper(i))
+		}
+	}
+	return 0
+}
+
+// bucketOf returns the histogram bucket of v.
+func bucketOf(v uint64) int {
+	if v < subBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - 1 - subBucketBits
+	return (shift+1)<<subBucketBits | int(v>>shift)&(subBuckets-1)
+}
+
+// bucketUpper returns the largest value of the bucket.
+func bucketUpper(i int) uint64 {
+	if i < subBuckets {
+		return uint64(i)
+	}
+	shift := i>>subBucketBits - 1
+	mantissa := uint64(subBuckets | i&(subBuckets-1))
+	return (mantissa+1)<<shift - 1
+}
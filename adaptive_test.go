@@ -0,0 +1,181 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveTimeout(t *testing.T) {
+	t.Parallel()
+
+	// observe records n latencies spread evenly over (0, top]
+	observe := func(a *AdaptiveTimeout, n int, top time.Duration) {
+		for i := 1; i <= n; i++ {
+			a.Observe(top * time.Duration(i) / time.Duration(n))
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		opts        AdaptiveOptions
+		observe     func(*AdaptiveTimeout)
+		expectedMin time.Duration
+		expectedMax time.Duration
+		description string
+	}{
+		{
+			name:        "initial before enough samples",
+			opts:        AdaptiveOptions{Initial: 3 * time.Second, MinSamples: 10},
+			observe:     func(a *AdaptiveTimeout) { observe(a, 9, time.Millisecond) },
+			expectedMin: 3 * time.Second,
+			expectedMax: 3 * time.Second,
+			description: "Too few samples should fall back to Initial",
+		},
+		{
+			name:        "max as initial",
+			opts:        AdaptiveOptions{Max: 5 * time.Second},
+			observe:     func(*AdaptiveTimeout) {},
+			expectedMin: 5 * time.Second,
+			expectedMax: 5 * time.Second,
+			description: "Max should be the initial timeout by default",
+		},
+		{
+			name:        "zero options",
+			opts:        AdaptiveOptions{},
+			observe:     func(*AdaptiveTimeout) {},
+			expectedMin: 0,
+			expectedMax: 0,
+			description: "Without Initial or Max there should be no timeout at first",
+		},
+		{
+			name:        "quantile times multiplier",
+			opts:        AdaptiveOptions{Quantile: 0.99, Multiplier: 2, Max: time.Minute},
+			observe:     func(a *AdaptiveTimeout) { observe(a, 1000, 100*time.Millisecond) },
+			expectedMin: 198 * time.Millisecond,
+			expectedMax: 198 * time.Millisecond * 9 / 8, // histogram precision
+			description: "Timeout should be p99 times two",
+		},
+		{
+			name:        "median",
+			opts:        AdaptiveOptions{Quantile: 0.5, Multiplier: 1},
+			observe:     func(a *AdaptiveTimeout) { observe(a, 1000, 100*time.Millisecond) },
+			expectedMin: 50 * time.Millisecond,
+			expectedMax: 50 * time.Millisecond * 9 / 8,
+			description: "Any quantile can be tracked",
+		},
+		{
+			name:        "clamped to min",
+			opts:        AdaptiveOptions{Min: time.Second},
+			observe:     func(a *AdaptiveTimeout) { observe(a, 1000, time.Millisecond) },
+			expectedMin: time.Second,
+			expectedMax: time.Second,
+			description: "Timeout should not drop below Min",
+		},
+		{
+			name:        "clamped to max",
+			opts:        AdaptiveOptions{Max: time.Second},
+			observe:     func(a *AdaptiveTimeout) { observe(a, 1000, time.Minute) },
+			expectedMin: time.Second,
+			expectedMax: time.Second,
+			description: "Timeout should not exceed Max",
+		},
+		{
+			name: "recent latencies dominate",
+			opts: AdaptiveOptions{Quantile: 0.5, Multiplier: 1, Window: 1000},
+			observe: func(a *AdaptiveTimeout) {
+				observe(a, 1000, time.Second)
+				for range 5000 {
+					a.Observe(10 * time.Millisecond)
+				}
+			},
+			expectedMin: 10 * time.Millisecond,
+			expectedMax: 10 * time.Millisecond * 9 / 8,
+			description: "Old latencies should fade out of the window",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			a := NewAdaptiveTimeout("db.query", tc.opts)
+			tc.observe(a)
+
+			timeout := a.Timeout()
+			assert.GreaterOrEqual(t, timeout, tc.expectedMin, tc.description)
+			assert.LessOrEqual(t, timeout, tc.expectedMax, tc.description)
+		})
+	}
+}
+
+func TestAdaptiveTimeoutDerive(t *testing.T) {
+	t.Parallel()
+
+	synctest.Run(func() {
+		a := NewAdaptiveTimeout("db.query", AdaptiveOptions{Initial: time.Second})
+
+		ctx := SetTraceID(context.Background(), "trace-adaptive")
+		parentCtx, cancelParent := context.WithTimeout(ctx, time.Millisecond)
+		defer cancelParent()
+
+		newCtx, cancel := a.Derive(parentCtx)
+		defer cancel()
+
+		assert.Equal(t, "trace-adaptive", GetTraceID(newCtx), "Values should be preserved")
+
+		deadline, ok := newCtx.Deadline()
+		assert.True(t, ok)
+		assert.Equal(t, time.Second, time.Until(deadline), "Parent deadline should be replaced")
+
+		sources := ExplainDeadline(newCtx)
+		require.NotEmpty(t, sources)
+		assert.Equal(t, "db.query", sources[len(sources)-1].Label, "Deadline should be labeled with the operation")
+
+		time.Sleep(time.Second)
+		synctest.Wait()
+
+		var timeoutErr *TimeoutError
+		require.ErrorAs(t, context.Cause(newCtx), &timeoutErr)
+		assert.Equal(t, "AdaptiveTimeout", timeoutErr.Operation)
+		assert.Equal(t, time.Second, timeoutErr.Budget)
+	})
+}
+
+func TestAdaptiveTimeoutDeriveZeroOptions(t *testing.T) {
+	t.Parallel()
+
+	synctest.Run(func() {
+		a := NewAdaptiveTimeout("db.query", AdaptiveOptions{})
+
+		newCtx, cancel := a.Derive(SetTraceID(context.Background(), "trace-adaptive"))
+
+		_, ok := newCtx.Deadline()
+		assert.False(t, ok, "No timeout should mean no deadline")
+		assert.Equal(t, "trace-adaptive", GetTraceID(newCtx), "Values should be preserved")
+
+		time.Sleep(time.Hour)
+		assert.NoError(t, newCtx.Err(), "Context should not start expired")
+
+		cancel()
+		assert.ErrorIs(t, newCtx.Err(), context.Canceled)
+	})
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []uint64{0, 1, 7, 8, 15, 16, 17, 1000, 1<<40 + 12345, 1<<63 - 1} {
+		i := bucketOf(v)
+		assert.Less(t, i, numBuckets)
+		assert.GreaterOrEqual(t, bucketUpper(i), v, "Bucket %d should hold %d", i, v)
+		if i > 0 {
+			assert.Less(t, bucketUpper(i-1), v, "Previous bucket should not hold %d", v)
+		}
+		assert.LessOrEqual(t, float64(bucketUpper(i)-v), float64(v)/subBuckets, "Relative error should be bounded")
+	}
+}
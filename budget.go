@@ -0,0 +1,113 @@
+package ctxutil
+
+import (
+	"context"
+	"time"
+)
+
+// Remaining returns the time left until the context's deadline.
+// ok is false if the context has no deadline.
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return deadline.Sub(clockFrom(ctx).Now()), true
+}
+
+// Reserve derives a context whose deadline is d earlier than the original one,
+// keeping headroom for work that must happen after the sub-call returns,
+// such as writing the response.
+// If the original context has no deadline, none is added.
+func Reserve(ctx context.Context, d time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		newCtx, cancel := context.WithCancel(ctx)
+		return newCtx, track("Reserve", cancel)
+	}
+	return withDeadline(ctx, deadline.Add(-d), "Reserve", newOptions(opts))
+}
+
+// Split derives one context per fraction for parallel sub-calls.
+// Each gets its fraction of the time remaining until the original deadline,
+// so Split(ctx, 0.5, 1) gives the first call half the budget
+// and the second all of it.
+// If the original context has no deadline, none is added.
+// The returned CancelFunc cancels every derived context.
+func Split(ctx context.Context, fractions ...float64) ([]context.Context, context.CancelFunc) {
+	return SplitWith(ctx, nil, fractions...)
+}
+
+// SplitWith is like Split, but applies the options to every derived context.
+func SplitWith(ctx context.Context, opts []Option, fractions ...float64) ([]context.Context, context.CancelFunc) {
+	remaining, hasDeadline := Remaining(ctx)
+	now := clockFrom(ctx).Now()
+	o := newOptions(opts)
+
+	ctxs := make([]context.Context, len(fractions))
+	cancels := make([]context.CancelFunc, len(fractions))
+	for i, f := range fractions {
+		if hasDeadline {
+			ctxs[i], cancels[i] = withDeadline(ctx, now.Add(scale(remaining, f)), "Split", o)
+		} else {
+			var cancel context.CancelFunc
+			ctxs[i], cancel = context.WithCancel(ctx)
+			cancels[i] = track("Split", cancel)
+		}
+	}
+
+	return ctxs, func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+}
+
+// Sequence hands out contexts for sequential sub-calls sharing one budget.
+// It is not safe for concurrent use.
+type Sequence struct {
+	ctx       context.Context
+	fractions []float64
+}
+
+// NewSequence splits the time remaining until the context's deadline
+// across sequential sub-calls according to the given fractions.
+// Budget left unused by one call rolls over to the following ones.
+func NewSequence(ctx context.Context, fractions ...float64) *Sequence {
+	return &Sequence{ctx: ctx, fractions: fractions}
+}
+
+// Next derives the context for the next sub-call.
+// Its share of the remaining budget is its fraction relative to the
+// fractions of the calls still to come, so the last call gets whatever is left.
+// Once every fraction is used, Next derives contexts with the original deadline.
+func (s *Sequence) Next(opts ...Option) (context.Context, context.CancelFunc) {
+	remaining, hasDeadline := Remaining(s.ctx)
+	if !hasDeadline || len(s.fractions) == 0 {
+		s.fractions = nil
+		return s.withoutDeadline()
+	}
+
+	var total float64
+	for _, f := range s.fractions {
+		total += f
+	}
+	share := s.fractions[0]
+	s.fractions = s.fractions[1:]
+
+	if total <= 0 {
+		return s.withoutDeadline()
+	}
+	return withDeadline(s.ctx, clockFrom(s.ctx).Now().Add(scale(remaining, share/total)), "Sequence", newOptions(opts))
+}
+
+// withoutDeadline derives a context that keeps the original deadline.
+func (s *Sequence) withoutDeadline() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	return ctx, track("Sequence", cancel)
+}
+
+// scale returns the fraction f of d.
+func scale(d time.Duration, f float64) time.Duration {
+	return time.Duration(float64(d) * f)
+}
@@ -0,0 +1,204 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemaining(t *testing.T) {
+	t.Parallel()
+
+	synctest.Run(func() {
+		_, ok := Remaining(context.Background())
+		assert.False(t, ok, "Context without deadline has no remaining budget")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 800*time.Millisecond)
+		defer cancel()
+
+		remaining, ok := Remaining(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, 800*time.Millisecond, remaining)
+
+		time.Sleep(300 * time.Millisecond)
+		remaining, _ = Remaining(ctx)
+		assert.Equal(t, 500*time.Millisecond, remaining, "Remaining budget should shrink with time")
+	})
+}
+
+func TestReserve(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		parentTimeout time.Duration // zero means no deadline
+		reserve       time.Duration
+		verify        func(*testing.T, context.Context)
+		description   string
+	}{
+		{
+			name:          "keeps headroom before parent deadline",
+			parentTimeout: 800 * time.Millisecond,
+			reserve:       100 * time.Millisecond,
+			verify: func(t *testing.T, ctx context.Context) {
+				remaining, ok := Remaining(ctx)
+				assert.True(t, ok)
+				assert.Equal(t, 700*time.Millisecond, remaining)
+			},
+			description: "Deadline should move earlier by the reserved duration",
+		},
+		{
+			name:          "reserve larger than budget expires immediately",
+			parentTimeout: 50 * time.Millisecond,
+			reserve:       100 * time.Millisecond,
+			verify: func(t *testing.T, ctx context.Context) {
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+			},
+			description: "No time left once headroom is reserved",
+		},
+		{
+			name:    "no deadline stays without deadline",
+			reserve: 100 * time.Millisecond,
+			verify: func(t *testing.T, ctx context.Context) {
+				_, ok := ctx.Deadline()
+				assert.False(t, ok)
+				assert.NoError(t, ctx.Err())
+			},
+			description: "Nothing to reserve from without a deadline",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				parentCtx, parentCancel := context.WithCancel(context.Background())
+				defer parentCancel()
+				if tc.parentTimeout > 0 {
+					parentCtx, parentCancel = context.WithTimeout(parentCtx, tc.parentTimeout)
+					defer parentCancel()
+				}
+				parentCtx = SetTraceID(parentCtx, "trace-reserve")
+
+				ctx, cancel := Reserve(parentCtx, tc.reserve)
+				defer cancel()
+
+				assert.Equal(t, "trace-reserve", GetTraceID(ctx), "Trace ID should be preserved")
+				tc.verify(t, ctx)
+			})
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		parentTimeout time.Duration // zero means no deadline
+		fractions     []float64
+		expected      []time.Duration
+		description   string
+	}{
+		{
+			name:          "parallel calls get their fraction",
+			parentTimeout: 800 * time.Millisecond,
+			fractions:     []float64{0.5, 0.25, 1},
+			expected:      []time.Duration{400 * time.Millisecond, 200 * time.Millisecond, 800 * time.Millisecond},
+			description:   "Each child should get its fraction of the budget",
+		},
+		{
+			name:          "fractions above one are capped by parent",
+			parentTimeout: 800 * time.Millisecond,
+			fractions:     []float64{2},
+			expected:      []time.Duration{800 * time.Millisecond},
+			description:   "Children can't outlive the parent",
+		},
+		{
+			name:        "no deadline",
+			fractions:   []float64{0.5, 0.5},
+			expected:    []time.Duration{0, 0},
+			description: "Children of a context without deadline have none",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				parentCtx, parentCancel := context.WithCancel(context.Background())
+				defer parentCancel()
+				if tc.parentTimeout > 0 {
+					parentCtx, parentCancel = context.WithTimeout(parentCtx, tc.parentTimeout)
+					defer parentCancel()
+				}
+				parentCtx = SetDeviceID(parentCtx, "device-split")
+
+				ctxs, cancel := Split(parentCtx, tc.fractions...)
+				defer cancel()
+
+				require.Len(t, ctxs, len(tc.fractions))
+				for i, ctx := range ctxs {
+					assert.Equal(t, "device-split", GetDeviceID(ctx), "Device ID should be preserved")
+
+					remaining, ok := Remaining(ctx)
+					assert.Equal(t, tc.expected[i] > 0, ok, tc.description)
+					assert.Equal(t, tc.expected[i], remaining, tc.description)
+				}
+
+				cancel()
+				for _, ctx := range ctxs {
+					assert.ErrorIs(t, ctx.Err(), context.Canceled, "Cancel should end every child")
+				}
+				assert.NoError(t, parentCtx.Err(), "Parent should not be canceled")
+			})
+		})
+	}
+}
+
+func TestSequence(t *testing.T) {
+	t.Parallel()
+
+	synctest.Run(func() {
+		parentCtx, parentCancel := context.WithTimeout(context.Background(), 900*time.Millisecond)
+		defer parentCancel()
+		parentCtx = SetTraceID(parentCtx, "trace-sequence")
+
+		seq := NewSequence(parentCtx, 1, 1, 1)
+
+		// first call gets a third of 900ms but only uses 100ms
+		ctx, cancel := seq.Next()
+		remaining, _ := Remaining(ctx)
+		assert.Equal(t, 300*time.Millisecond, remaining)
+		assert.Equal(t, "trace-sequence", GetTraceID(ctx), "Trace ID should be preserved")
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+
+		// unused budget rolls over: half of the 800ms left
+		ctx, cancel = seq.Next()
+		remaining, _ = Remaining(ctx)
+		assert.Equal(t, 400*time.Millisecond, remaining)
+		time.Sleep(remaining)
+		synctest.Wait()
+		assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded, "Call exceeding its share should time out")
+		cancel()
+
+		// last call gets whatever is left
+		ctx, cancel = seq.Next()
+		remaining, _ = Remaining(ctx)
+		assert.Equal(t, 400*time.Millisecond, remaining)
+		cancel()
+
+		// beyond the planned calls, the original deadline applies
+		ctx, cancel = seq.Next()
+		defer cancel()
+		remaining, _ = Remaining(ctx)
+		assert.Equal(t, 400*time.Millisecond, remaining)
+	})
+}
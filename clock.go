@@ -0,0 +1,214 @@
+package ctxutil
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time and schedules timers for the package's timeout helpers.
+// Implementations must be safe for concurrent use.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// C returns the channel the time is delivered on. It is nil for AfterFunc timers.
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return realTimer{time.AfterFunc(d, f)} }
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+// clockHolder lets a Clock interface live in an atomic.Pointer.
+type clockHolder struct {
+	clock Clock
+}
+
+var defaultClock atomic.Pointer[clockHolder]
+
+// SetClock installs the clock used by the timeout helpers
+// for contexts without their own clock, see WithClock.
+// Passing nil restores the real clock.
+func SetClock(clock Clock) {
+	if clock == nil {
+		defaultClock.Store(nil)
+		return
+	}
+	defaultClock.Store(&clockHolder{clock: clock})
+}
+
+// WithClock sets the clock used by the timeout helpers for this context
+// and the contexts they derive from it, taking precedence over the one
+// installed with SetClock.
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return update(ctx, func(v *contextValues) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		v.clock = clock
+	})
+}
+
+// clockFrom returns the context's clock, falling back to the installed one.
+func clockFrom(ctx context.Context) Clock {
+	vals := getValues(ctx)
+	vals.mu.Lock()
+	clock := vals.clock
+	vals.mu.Unlock()
+
+	if clock != nil {
+		return clock
+	}
+	if h := defaultClock.Load(); h != nil {
+		return h.clock
+	}
+	return realClock{}
+}
+
+// isRealClock reports whether clock is the real clock.
+func isRealClock(clock Clock) bool {
+	_, ok := clock.(realClock)
+	return ok
+}
+
+// ManualClock is a fake Clock for tests that only moves when told to.
+// Timers due after a call to Advance fire before it returns,
+// in deadline order, with AfterFunc callbacks run synchronously.
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*manualTimer]struct{}
+}
+
+// NewManualClock creates a manual clock set to start.
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start, timers: make(map[*manualTimer]struct{})}
+}
+
+// Now returns the clock's current time.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer creates a timer that delivers the time on its channel after d.
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	t := &manualTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc creates a timer that calls f after d.
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &manualTimer{clock: c, fn: f}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers that become due.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+
+	for {
+		// timers may be added or reset by callbacks, so look again each time
+		var next *manualTimer
+		for t := range c.timers {
+			if !t.when.After(target) && (next == nil || t.when.Before(next.when)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		delete(c.timers, next)
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		now := c.now
+		c.mu.Unlock()
+
+		next.fire(now)
+
+		c.mu.Lock()
+	}
+
+	c.now = target
+	c.mu.Unlock()
+}
+
+// manualTimer is a Timer driven by a ManualClock.
+type manualTimer struct {
+	clock *ManualClock
+	ch    chan time.Time
+	fn    func()
+	when  time.Time // guarded by clock.mu
+}
+
+func (t *manualTimer) C() <-chan time.Time { return t.ch }
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	return active
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	_, active := t.clock.timers[t]
+	t.when = t.clock.now.Add(d)
+	t.clock.timers[t] = struct{}{}
+	due := d <= 0
+	now := t.clock.now
+	if due {
+		delete(t.clock.timers, t)
+	}
+	t.clock.mu.Unlock()
+
+	if due {
+		if t.fn != nil {
+			// like time.AfterFunc, don't run the callback on the caller's goroutine
+			go t.fn()
+		} else {
+			t.fire(now)
+		}
+	}
+	return active
+}
+
+// fire delivers the time or runs the callback.
+func (t *manualTimer) fire(now time.Time) {
+	if t.fn != nil {
+		t.fn()
+		return
+	}
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
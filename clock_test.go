@@ -0,0 +1,313 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var clockEpoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestManualClock(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, *ManualClock)
+		description string
+	}{
+		{
+			name: "now only moves on advance",
+			verify: func(t *testing.T, clock *ManualClock) {
+				assert.Equal(t, clockEpoch, clock.Now())
+				clock.Advance(time.Hour)
+				assert.Equal(t, clockEpoch.Add(time.Hour), clock.Now())
+			},
+			description: "Manual time should not follow the wall clock",
+		},
+		{
+			name: "timer delivers on channel",
+			verify: func(t *testing.T, clock *ManualClock) {
+				timer := clock.NewTimer(time.Second)
+
+				clock.Advance(999 * time.Millisecond)
+				assert.Empty(t, timer.C(), "Timer should not fire early")
+
+				clock.Advance(time.Millisecond)
+				require.Len(t, timer.C(), 1)
+				assert.Equal(t, clockEpoch.Add(time.Second), <-timer.C())
+			},
+			description: "Timers should deliver the fire time",
+		},
+		{
+			name: "after func runs in deadline order",
+			verify: func(t *testing.T, clock *ManualClock) {
+				var fired []string
+				clock.AfterFunc(2*time.Second, func() { fired = append(fired, "second") })
+				clock.AfterFunc(time.Second, func() { fired = append(fired, "first") })
+				clock.AfterFunc(time.Minute, func() { fired = append(fired, "late") })
+
+				clock.Advance(5 * time.Second)
+				assert.Equal(t, []string{"first", "second"}, fired)
+			},
+			description: "Due callbacks should run before Advance returns",
+		},
+		{
+			name: "callbacks see their fire time",
+			verify: func(t *testing.T, clock *ManualClock) {
+				var seen time.Time
+				clock.AfterFunc(time.Second, func() { seen = clock.Now() })
+				clock.Advance(time.Hour)
+				assert.Equal(t, clockEpoch.Add(time.Second), seen)
+			},
+			description: "Now should report the timer's deadline inside its callback",
+		},
+		{
+			name: "stop and reset",
+			verify: func(t *testing.T, clock *ManualClock) {
+				var fired int
+				timer := clock.AfterFunc(time.Second, func() { fired++ })
+
+				assert.True(t, timer.Stop(), "Stopping an active timer should report true")
+				assert.False(t, timer.Stop(), "Stopping a stopped timer should report false")
+				clock.Advance(time.Hour)
+				assert.Zero(t, fired)
+
+				assert.False(t, timer.Reset(time.Second), "Resetting a stopped timer should report false")
+				clock.Advance(time.Second)
+				assert.Equal(t, 1, fired)
+			},
+			description: "Stopped timers should not fire until reset",
+		},
+		{
+			name: "callbacks can rearm within one advance",
+			verify: func(t *testing.T, clock *ManualClock) {
+				var fired int
+				var timer Timer
+				timer = clock.AfterFunc(time.Second, func() {
+					fired++
+					timer.Reset(time.Second)
+				})
+				clock.Advance(5 * time.Second)
+				assert.Equal(t, 5, fired)
+			},
+			description: "Timers reset by callbacks should fire again if due",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.verify(t, NewManualClock(clockEpoch))
+		})
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, context.Context, *ManualClock)
+		description string
+	}{
+		{
+			name: "extend timeout",
+			verify: func(t *testing.T, ctx context.Context, clock *ManualClock) {
+				newCtx, cancel := ExtendTimeout(ctx, time.Minute)
+				defer cancel()
+
+				deadline, ok := newCtx.Deadline()
+				assert.True(t, ok)
+				assert.Equal(t, clockEpoch.Add(time.Minute), deadline)
+				assert.Equal(t, "trace-clock", GetTraceID(newCtx), "Trace ID should be preserved")
+
+				clock.Advance(59 * time.Second)
+				assert.NoError(t, newCtx.Err())
+
+				clock.Advance(time.Second)
+				assert.ErrorIs(t, newCtx.Err(), context.DeadlineExceeded)
+
+				var timeoutErr *TimeoutError
+				require.ErrorAs(t, context.Cause(newCtx), &timeoutErr)
+				assert.Equal(t, time.Minute, timeoutErr.Budget)
+			},
+			description: "ExtendTimeout should follow the manual clock",
+		},
+		{
+			name: "linked to a derived context",
+			verify: func(t *testing.T, ctx context.Context, clock *ManualClock) {
+				parentCtx, cancelParent := ExtendTimeout(ctx, time.Second)
+				defer cancelParent()
+				childCtx, cancelChild := context.WithCancel(parentCtx)
+				defer cancelChild()
+
+				linkedCtx, cancel := ExtendTimeoutLinked(childCtx, time.Minute)
+				defer cancel()
+
+				clock.Advance(time.Second)
+				assert.ErrorIs(t, childCtx.Err(), context.DeadlineExceeded)
+				assert.Never(t, func() bool { return linkedCtx.Err() != nil }, 50*time.Millisecond, time.Millisecond,
+					"Expiry seen through a derived context should not cancel the linked context")
+			},
+			description: "Derived contexts should report the expiry as a timeout",
+		},
+		{
+			name: "cancel before deadline",
+			verify: func(t *testing.T, ctx context.Context, clock *ManualClock) {
+				newCtx, cancel := CapTimeout(ctx, time.Minute)
+				cancel()
+				clock.Advance(time.Hour)
+				assert.ErrorIs(t, newCtx.Err(), context.Canceled)
+			},
+			description: "Canceled contexts should not report a timeout",
+		},
+		{
+			name: "budget helpers",
+			verify: func(t *testing.T, ctx context.Context, clock *ManualClock) {
+				parentCtx, cancelParent := ExtendTimeout(ctx, time.Second)
+				defer cancelParent()
+
+				reserved, cancel := Reserve(parentCtx, 200*time.Millisecond)
+				defer cancel()
+
+				remaining, ok := Remaining(reserved)
+				assert.True(t, ok)
+				assert.Equal(t, 800*time.Millisecond, remaining)
+
+				ctxs, cancelSplit := Split(parentCtx, 0.5)
+				defer cancelSplit()
+
+				clock.Advance(500 * time.Millisecond)
+				assert.ErrorIs(t, ctxs[0].Err(), context.DeadlineExceeded)
+				assert.NoError(t, reserved.Err())
+
+				clock.Advance(500 * time.Millisecond)
+				assert.ErrorIs(t, reserved.Err(), context.DeadlineExceeded, "Parent expiry should propagate")
+			},
+			description: "Budgets should be computed from the manual clock",
+		},
+		{
+			name: "lease",
+			verify: func(t *testing.T, ctx context.Context, clock *ManualClock) {
+				leaseCtx, renew, cancel := WithLease(ctx, 10*time.Second)
+				defer cancel()
+				child, cancelChild := context.WithCancel(leaseCtx)
+				defer cancelChild()
+
+				clock.Advance(9 * time.Second)
+				renew()
+				clock.Advance(9 * time.Second)
+				assert.NoError(t, leaseCtx.Err())
+
+				clock.Advance(time.Second)
+				assert.ErrorIs(t, leaseCtx.Err(), context.DeadlineExceeded)
+				assert.ErrorIs(t, child.Err(), context.DeadlineExceeded, "Derived contexts should see the expiry right away")
+			},
+			description: "Leases should follow the manual clock",
+		},
+		{
+			name: "idle timeout",
+			verify: func(t *testing.T, ctx context.Context, clock *ManualClock) {
+				idleCtx, touch, cancel := WithIdleTimeout(ctx, 30*time.Second)
+				defer cancel()
+
+				clock.Advance(20 * time.Second)
+				touch()
+				clock.Advance(29 * time.Second)
+				assert.NoError(t, idleCtx.Err())
+
+				clock.Advance(time.Second)
+				assert.ErrorIs(t, context.Cause(idleCtx), ErrIdleTimeout)
+			},
+			description: "Idle timeouts should follow the manual clock",
+		},
+		{
+			name: "pausable timeout",
+			verify: func(t *testing.T, ctx context.Context, clock *ManualClock) {
+				pausable, cancel := WithPausableTimeout(ctx, 10*time.Second)
+				defer cancel()
+				child, cancelChild := context.WithTimeout(pausable, time.Hour)
+				defer cancelChild()
+
+				clock.Advance(4 * time.Second)
+				pausable.Pause()
+				clock.Advance(time.Hour)
+				pausable.Resume()
+				assert.Equal(t, 4*time.Second, pausable.Consumed())
+
+				clock.Advance(6 * time.Second)
+				assert.ErrorIs(t, pausable.Err(), context.DeadlineExceeded)
+				assert.ErrorIs(t, child.Err(), context.DeadlineExceeded, "Derived contexts should see the expiry right away")
+			},
+			description: "Pausable budgets should follow the manual clock",
+		},
+		{
+			name: "grace period",
+			verify: func(t *testing.T, ctx context.Context, clock *ManualClock) {
+				parentCtx, cancelParent := context.WithCancel(ctx)
+				graceCtx, cancel := AfterCancel(parentCtx, 5*time.Second)
+				defer cancel()
+
+				cancelParent()
+				assert.Eventually(t, func() bool {
+					_, ok := graceCtx.Deadline()
+					return ok
+				}, time.Second, time.Millisecond, "Grace period should start once the parent is done")
+
+				child, cancelChild := context.WithCancel(graceCtx)
+				defer cancelChild()
+
+				clock.Advance(5 * time.Second)
+				assert.ErrorIs(t, graceCtx.Err(), context.DeadlineExceeded)
+				assert.ErrorIs(t, child.Err(), context.DeadlineExceeded, "Derived contexts should see the expiry right away")
+			},
+			description: "Grace periods should follow the manual clock",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := NewManualClock(clockEpoch)
+			ctx := SetTraceID(context.Background(), "trace-clock")
+			ctx = WithClock(ctx, clock)
+
+			tc.verify(t, ctx, clock)
+		})
+	}
+}
+
+// not parallel: swaps the package clock
+func TestSetClock(t *testing.T) {
+	t.Cleanup(func() { SetClock(nil) })
+
+	clock := NewManualClock(clockEpoch)
+	SetClock(clock)
+
+	ctx, cancel := ExtendTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clock.Advance(time.Minute)
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded, "Installed clock should be used by default")
+
+	// a context's own clock wins over the installed one
+	own := NewManualClock(clockEpoch)
+	ctx, cancel = ExtendTimeout(WithClock(context.Background(), own), time.Minute)
+	defer cancel()
+
+	clock.Advance(time.Hour)
+	assert.NoError(t, ctx.Err())
+	own.Advance(time.Minute)
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+	SetClock(nil)
+	remaining, ok := Remaining(ctx)
+	assert.True(t, ok)
+	assert.Zero(t, remaining, "Context clock should still apply after the installed one is removed")
+}
@@ -2,14 +2,33 @@ package ctxutil
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 )
 
+// ErrParentCanceled is the cancellation cause of a linked context
+// whose parent was explicitly canceled, see ExtendTimeoutLinked.
+var ErrParentCanceled = errors.New("ctxutil: parent context canceled")
+
 type contextKey struct{}
 
 type contextValues struct {
-	deviceID string
-	traceID  string
+	deviceID  string
+	traceID   string
+	requestID string
+
+	// mu guards the fields below, which may be filled lazily
+	// by concurrent readers of the same request context.
+	mu           sync.Mutex
+	flags        map[string]any
+	flagProvider FlagProvider
+	flagCache    map[string]*flagSnapshot // keyed by device ID
+	assignments  map[string]string        // experiment -> variant
+	overrides    map[string]string        // experiment -> forced variant
+	idGenerator  IDGenerator
+	clock        Clock
 	// moar fields as needed
 }
 
@@ -33,15 +52,81 @@ func GetTraceID(ctx context.Context) string {
 	return getString(ctx, func(v *contextValues) string { return v.traceID })
 }
 
+// SetRequestID sets the request ID in the context.
+func SetRequestID(ctx context.Context, requestID string) context.Context {
+	return setString(ctx, func(v *contextValues, s string) { v.requestID = s }, requestID)
+}
+
+// GetRequestID gets the request ID from the context.
+func GetRequestID(ctx context.Context) string {
+	return getString(ctx, func(v *contextValues) string { return v.requestID })
+}
+
 // ExtendTimeout creates a fresh context with the given timeout
 // and carries over known values from the original context.
 // It works both for adding a timeout to contexts without one
 // and for replacing/extending an existing timeout.
-func ExtendTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
-	newCtx, cancel := context.WithTimeout(context.Background(), timeout)
-	vals := getValues(ctx)
-	if vals != nil {
-		newCtx = withValues(newCtx, vals)
+// Once the timeout is reached, context.Cause reports a *TimeoutError,
+// unless another cause is set with WithCause.
+func ExtendTimeout(ctx context.Context, timeout time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	return withDeadline(detach(ctx), clockFrom(ctx).Now().Add(timeout), "ExtendTimeout", newOptions(opts))
+}
+
+// ExtendTimeoutKeepAll is like ExtendTimeout, but carries over every value
+// of the original context, not just the known ones.
+// Value lookups are delegated to the original context chain,
+// while its deadline and cancellation are ignored.
+func ExtendTimeoutKeepAll(ctx context.Context, timeout time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	return withDeadline(context.WithoutCancel(ctx), clockFrom(ctx).Now().Add(timeout), "ExtendTimeoutKeepAll", newOptions(opts))
+}
+
+// ExtendTimeoutLinked is like ExtendTimeout, but the new context is still
+// canceled when the original context is explicitly canceled,
+// for instance when the client disconnects.
+// The original context merely reaching its deadline doesn't cancel it.
+// When canceled through the parent, context.Cause reports an error
+// wrapping both ErrParentCanceled and the parent's cause.
+func ExtendTimeoutLinked(ctx context.Context, timeout time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	linkedCtx, cancelLinked := context.WithCancelCause(detach(ctx))
+	newCtx, cancelTimeout := withDeadline(linkedCtx, clockFrom(ctx).Now().Add(timeout), "ExtendTimeoutLinked", newOptions(opts))
+
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancelLinked(fmt.Errorf("%w: %w", ErrParentCanceled, context.Cause(ctx)))
+		}
+	})
+
+	return newCtx, func() {
+		stop()
+		cancelTimeout()
+		cancelLinked(context.Canceled)
+	}
+}
+
+// ExtendDeadline is like ExtendTimeout, but takes an absolute deadline.
+func ExtendDeadline(ctx context.Context, deadline time.Time, opts ...Option) (context.Context, context.CancelFunc) {
+	return withDeadline(detach(ctx), deadline, "ExtendDeadline", newOptions(opts))
+}
+
+// CapTimeout is like ExtendTimeout, but never extends the deadline:
+// the new context ends after the timeout or at the original context's
+// deadline, whichever comes first.
+func CapTimeout(ctx context.Context, timeout time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	deadline := clockFrom(ctx).Now().Add(timeout)
+	if current, ok := ctx.Deadline(); ok && current.Before(deadline) {
+		deadline = current
+	}
+	return withDeadline(detach(ctx), deadline, "CapTimeout", newOptions(opts))
+}
+
+// FloorTimeout is like ExtendTimeout, but never shortens the deadline:
+// the new context ends after the timeout or at the original context's
+// deadline, whichever comes last.
+// If the original context has no deadline, the timeout applies.
+func FloorTimeout(ctx context.Context, timeout time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	deadline := clockFrom(ctx).Now().Add(timeout)
+	if current, ok := ctx.Deadline(); ok && current.After(deadline) {
+		deadline = current
 	}
-	return newCtx, cancel
+	return withDeadline(detach(ctx), deadline, "FloorTimeout", newOptions(opts))
 }
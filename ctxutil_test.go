@@ -2,6 +2,7 @@ package ctxutil
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"testing/synctest"
 	"time"
@@ -159,6 +160,59 @@ func TestTraceID(t *testing.T) {
 	}
 }
 
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		setup         func() context.Context
+		operation     func(context.Context) context.Context
+		expectedValue string
+		description   string
+	}{
+		{
+			name:          "get from empty context returns empty string",
+			setup:         func() context.Context { return context.Background() },
+			operation:     func(ctx context.Context) context.Context { return ctx },
+			expectedValue: "",
+			description:   "Getting RequestID from empty context should return empty string",
+		},
+		{
+			name: "set and get simple value",
+			setup: func() context.Context {
+				return context.Background()
+			},
+			operation: func(ctx context.Context) context.Context {
+				return SetRequestID(ctx, "request-123")
+			},
+			expectedValue: "request-123",
+			description:   "RequestID should be retrievable after being set",
+		},
+		{
+			name: "does not clobber other values",
+			setup: func() context.Context {
+				return SetTraceID(context.Background(), "trace-123")
+			},
+			operation: func(ctx context.Context) context.Context {
+				return SetRequestID(ctx, "request-123")
+			},
+			expectedValue: "request-123",
+			description:   "RequestID should live alongside other values",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := tc.setup()
+			ctx = tc.operation(ctx)
+
+			assert.Equal(t, tc.expectedValue, GetRequestID(ctx), tc.description)
+		})
+	}
+}
+
 func TestExtendTimeout(t *testing.T) {
 	t.Parallel()
 
@@ -315,3 +369,295 @@ func TestExtendTimeoutSharedValues(t *testing.T) {
 		assert.NoError(t, parentCtx.Err(), "Parent context should remain valid")
 	})
 }
+
+func TestExtendTimeoutKeepAll(t *testing.T) {
+	t.Parallel()
+
+	type foreignKey struct{}
+
+	testCases := []struct {
+		name        string
+		setupCtx    func() (context.Context, context.CancelFunc)
+		timeout     time.Duration
+		verify      func(*testing.T, context.Context, context.CancelFunc)
+		description string
+	}{
+		{
+			name: "foreign and known values are preserved",
+			setupCtx: func() (context.Context, context.CancelFunc) {
+				ctx := context.WithValue(context.Background(), foreignKey{}, "db-tx")
+				ctx = SetTraceID(ctx, "trace-keep-all")
+				return ctx, func() {}
+			},
+			timeout: time.Second,
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc) {
+				assert.Equal(t, "db-tx", ctx.Value(foreignKey{}), "Foreign value should be preserved")
+				assert.Equal(t, "trace-keep-all", GetTraceID(ctx), "Trace ID should be preserved")
+			},
+			description: "Every value of the original chain should be visible",
+		},
+		{
+			name: "deadline is replaced",
+			setupCtx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Millisecond)
+			},
+			timeout: time.Hour,
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc) {
+				deadline, ok := ctx.Deadline()
+				assert.True(t, ok)
+				assert.Equal(t, time.Hour, time.Until(deadline), "Deadline should come from the new timeout")
+
+				time.Sleep(time.Second)
+				synctest.Wait()
+				assert.NoError(t, ctx.Err(), "Original deadline should not apply")
+			},
+			description: "The original deadline should be ignored",
+		},
+		{
+			name: "parent cancellation doesn't affect extended context",
+			setupCtx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			timeout: time.Hour,
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc) {
+				assert.NoError(t, ctx.Err())
+			},
+			description: "Canceling the original context should not cancel the extended one",
+		},
+		{
+			name: "context correctly times out",
+			setupCtx: func() (context.Context, context.CancelFunc) {
+				return context.Background(), func() {}
+			},
+			timeout: 10 * time.Millisecond,
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc) {
+				time.Sleep(11 * time.Millisecond)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+			},
+			description: "The new timeout should apply",
+		},
+		{
+			name: "cancel works immediately",
+			setupCtx: func() (context.Context, context.CancelFunc) {
+				return context.Background(), func() {}
+			},
+			timeout: time.Hour,
+			verify: func(t *testing.T, ctx context.Context, cancel context.CancelFunc) {
+				cancel()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+			},
+			description: "Cancel should end the extended context",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				origCtx, origCancel := tc.setupCtx()
+				defer origCancel()
+
+				newCtx, cancel := ExtendTimeoutKeepAll(origCtx, tc.timeout)
+				defer cancel()
+
+				// the original context ending first must not matter
+				origCancel()
+				synctest.Wait()
+
+				tc.verify(t, newCtx, cancel)
+			})
+		})
+	}
+}
+
+func TestExtendTimeoutLinked(t *testing.T) {
+	t.Parallel()
+
+	errClientGone := errors.New("client disconnected")
+
+	testCases := []struct {
+		name        string
+		timeout     time.Duration
+		parentTTL   time.Duration
+		act         func(context.CancelCauseFunc)
+		verify      func(*testing.T, context.Context)
+		description string
+	}{
+		{
+			name:      "parent cancellation cancels linked context",
+			timeout:   time.Hour,
+			parentTTL: time.Hour,
+			act:       func(cancel context.CancelCauseFunc) { cancel(errClientGone) },
+			verify: func(t *testing.T, ctx context.Context) {
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+				assert.ErrorIs(t, context.Cause(ctx), ErrParentCanceled, "Cause should tell parent cancellation apart")
+				assert.ErrorIs(t, context.Cause(ctx), errClientGone, "Cause should wrap the parent's cause")
+			},
+			description: "Explicit parent cancellation should propagate",
+		},
+		{
+			name:      "parent deadline doesn't cancel linked context",
+			timeout:   time.Hour,
+			parentTTL: 10 * time.Millisecond,
+			act:       func(context.CancelCauseFunc) { time.Sleep(20 * time.Millisecond) },
+			verify: func(t *testing.T, ctx context.Context) {
+				assert.NoError(t, ctx.Err(), "Parent deadline should not apply")
+			},
+			description: "The extended deadline should replace the parent's",
+		},
+		{
+			name:      "linked context times out",
+			timeout:   10 * time.Millisecond,
+			parentTTL: time.Hour,
+			act:       func(context.CancelCauseFunc) { time.Sleep(20 * time.Millisecond) },
+			verify: func(t *testing.T, ctx context.Context) {
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+				assert.NotErrorIs(t, context.Cause(ctx), ErrParentCanceled)
+			},
+			description: "The new timeout should apply",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				parentCtx, cancelParent := context.WithCancelCause(context.Background())
+				defer cancelParent(nil)
+				parentCtx, cancelTimeout := context.WithTimeout(parentCtx, tc.parentTTL)
+				defer cancelTimeout()
+				parentCtx = SetDeviceID(parentCtx, "device-linked")
+
+				newCtx, cancel := ExtendTimeoutLinked(parentCtx, tc.timeout)
+				defer cancel()
+				assert.Equal(t, "device-linked", GetDeviceID(newCtx), "Device ID should be preserved")
+
+				tc.act(cancelParent)
+				synctest.Wait()
+
+				tc.verify(t, newCtx)
+			})
+		})
+	}
+}
+
+func TestDeadlineClamps(t *testing.T) {
+	t.Parallel()
+
+	type constructor func(context.Context) (context.Context, context.CancelFunc)
+
+	testCases := []struct {
+		name             string
+		parentTimeout    time.Duration // zero means no deadline
+		construct        constructor
+		expectedTimeLeft time.Duration
+		description      string
+	}{
+		{
+			name:          "extend deadline beyond parent",
+			parentTimeout: time.Second,
+			construct: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return ExtendDeadline(ctx, time.Now().Add(time.Minute))
+			},
+			expectedTimeLeft: time.Minute,
+			description:      "ExtendDeadline should replace the deadline",
+		},
+		{
+			name: "extend deadline without parent deadline",
+			construct: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return ExtendDeadline(ctx, time.Now().Add(time.Second))
+			},
+			expectedTimeLeft: time.Second,
+			description:      "ExtendDeadline should add a deadline",
+		},
+		{
+			name:          "cap keeps earlier parent deadline",
+			parentTimeout: time.Second,
+			construct: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return CapTimeout(ctx, time.Minute)
+			},
+			expectedTimeLeft: time.Second,
+			description:      "CapTimeout should never extend the deadline",
+		},
+		{
+			name:          "cap shortens later parent deadline",
+			parentTimeout: time.Minute,
+			construct: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return CapTimeout(ctx, time.Second)
+			},
+			expectedTimeLeft: time.Second,
+			description:      "CapTimeout should shorten the deadline",
+		},
+		{
+			name: "cap without parent deadline",
+			construct: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return CapTimeout(ctx, time.Second)
+			},
+			expectedTimeLeft: time.Second,
+			description:      "CapTimeout should add a deadline",
+		},
+		{
+			name:          "floor keeps later parent deadline",
+			parentTimeout: time.Minute,
+			construct: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return FloorTimeout(ctx, time.Second)
+			},
+			expectedTimeLeft: time.Minute,
+			description:      "FloorTimeout should never shorten the deadline",
+		},
+		{
+			name:          "floor extends earlier parent deadline",
+			parentTimeout: time.Second,
+			construct: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return FloorTimeout(ctx, time.Minute)
+			},
+			expectedTimeLeft: time.Minute,
+			description:      "FloorTimeout should extend the deadline",
+		},
+		{
+			name: "floor without parent deadline",
+			construct: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return FloorTimeout(ctx, time.Second)
+			},
+			expectedTimeLeft: time.Second,
+			description:      "FloorTimeout should add a deadline",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				parentCtx, parentCancel := context.WithCancel(context.Background())
+				defer parentCancel()
+				if tc.parentTimeout > 0 {
+					parentCtx, parentCancel = context.WithTimeout(parentCtx, tc.parentTimeout)
+					defer parentCancel()
+				}
+				parentCtx = SetDeviceID(parentCtx, "device-clamp")
+
+				newCtx, cancel := tc.construct(parentCtx)
+				defer cancel()
+
+				assert.Equal(t, "device-clamp", GetDeviceID(newCtx), "Device ID should be preserved")
+
+				deadline, ok := newCtx.Deadline()
+				assert.True(t, ok, "New context should have a deadline")
+				assert.Equal(t, tc.expectedTimeLeft, time.Until(deadline), tc.description)
+
+				// the parent's cancellation must not leak into the new context
+				parentCancel()
+				synctest.Wait()
+				assert.NoError(t, newCtx.Err(), "Parent cancellation should not affect the new context")
+
+				time.Sleep(tc.expectedTimeLeft)
+				synctest.Wait()
+				assert.ErrorIs(t, newCtx.Err(), context.DeadlineExceeded, "New context should end at its deadline")
+			})
+		})
+	}
+}
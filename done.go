@@ -0,0 +1,101 @@
+package ctxutil
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// doneHook is a hook registered with OnDone, along with the context
+// it was registered for, whose values it gets.
+type doneHook struct {
+	ctx context.Context
+	fn  func(context.Context, error)
+}
+
+// doneHooks are the hooks registered with OnDone for one Done channel.
+type doneHooks struct {
+	stop   func() bool // stops the context.AfterFunc running the hooks
+	hooks  map[uint64]doneHook
+	nextID uint64
+}
+
+// hooks holds the pending OnDone hooks, keyed by Done channel so that
+// contexts sharing it, like a context and its values, share one list.
+// Each hook still gets the values of its own context.
+var hooks struct {
+	mu      sync.Mutex
+	pending map[<-chan struct{}]*doneHooks
+}
+
+// OnDone arranges for fn to run once ctx is done, with the cause of ctx and
+// a fresh context that carries over its known values, like ExtendTimeout,
+// so the hook can still log the trace ID.
+// Hooks registered for the same context before it's done run one after
+// another, in registration order, on a single goroutine. Calling stop
+// unregisters fn; it reports whether fn was stopped before it started.
+// Hooks for a context that is never done, like context.Background, never run.
+func OnDone(ctx context.Context, fn func(ctx context.Context, cause error)) (stop func() bool) {
+	done := ctx.Done()
+	if done == nil {
+		return func() bool { return false }
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+
+	if hooks.pending == nil {
+		hooks.pending = make(map[<-chan struct{}]*doneHooks)
+	}
+	h, ok := hooks.pending[done]
+	if !ok {
+		h = &doneHooks{hooks: make(map[uint64]doneHook)}
+		h.stop = context.AfterFunc(ctx, func() { runHooks(ctx, done, h) })
+		hooks.pending[done] = h
+	}
+
+	id := h.nextID
+	h.nextID++
+	h.hooks[id] = doneHook{ctx: ctx, fn: fn}
+
+	return func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+
+		if _, ok := h.hooks[id]; !ok {
+			return false
+		}
+		delete(h.hooks, id)
+		if len(h.hooks) == 0 && hooks.pending[done] == h && h.stop() {
+			delete(hooks.pending, done)
+		}
+		return true
+	}
+}
+
+// runHooks runs the hooks in registration order.
+func runHooks(ctx context.Context, done <-chan struct{}, h *doneHooks) {
+	hooks.mu.Lock()
+	if hooks.pending[done] == h {
+		delete(hooks.pending, done)
+	}
+	ids := make([]uint64, 0, len(h.hooks))
+	for id := range h.hooks {
+		ids = append(ids, id)
+	}
+	hooks.mu.Unlock()
+
+	slices.Sort(ids)
+
+	cause := context.Cause(ctx)
+	for _, id := range ids {
+		hooks.mu.Lock()
+		hook, ok := h.hooks[id]
+		delete(h.hooks, id)
+		hooks.mu.Unlock()
+
+		if ok {
+			hook.fn(detach(hook.ctx), cause)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnDone(t *testing.T) {
+	t.Parallel()
+
+	errClient := errors.New("client went away")
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, context.Context, context.CancelCauseFunc)
+		description string
+	}{
+		{
+			name: "hook sees values and cause",
+			verify: func(t *testing.T, ctx context.Context, cancel context.CancelCauseFunc) {
+				var (
+					traceID string
+					cause   error
+					hookErr error
+				)
+				OnDone(ctx, func(hookCtx context.Context, c error) {
+					traceID, cause, hookErr = GetTraceID(hookCtx), c, hookCtx.Err()
+				})
+
+				cancel(errClient)
+				synctest.Wait()
+
+				assert.Equal(t, "trace-done", traceID, "Hook context should carry the values")
+				assert.ErrorIs(t, cause, errClient, "Hook should get the cause")
+				assert.NoError(t, hookErr, "Hook context should not be done")
+			},
+			description: "Hooks should be able to log the request",
+		},
+		{
+			name: "hooks run in registration order",
+			verify: func(t *testing.T, ctx context.Context, cancel context.CancelCauseFunc) {
+				var order []int
+				for i := range 5 {
+					OnDone(ctx, func(context.Context, error) { order = append(order, i) })
+				}
+				// a derived context that shares the Done channel shares the list
+				OnDone(SetDeviceID(ctx, "device-done"), func(context.Context, error) { order = append(order, 5) })
+
+				cancel(nil)
+				synctest.Wait()
+				assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, order)
+			},
+			description: "Hooks should run one after another in order",
+		},
+		{
+			name: "hooks get their own context's values",
+			verify: func(t *testing.T, _ context.Context, _ context.CancelCauseFunc) {
+				// contexts without a values store get one each
+				baseCtx, cancelBase := context.WithCancel(context.Background())
+				firstCtx := SetTraceID(baseCtx, "trace-first")
+				secondCtx := SetTraceID(baseCtx, "trace-second")
+
+				var traceIDs []string
+				OnDone(firstCtx, func(hookCtx context.Context, _ error) { traceIDs = append(traceIDs, GetTraceID(hookCtx)) })
+				OnDone(secondCtx, func(hookCtx context.Context, _ error) { traceIDs = append(traceIDs, GetTraceID(hookCtx)) })
+
+				cancelBase()
+				synctest.Wait()
+				assert.Equal(t, []string{"trace-first", "trace-second"}, traceIDs)
+			},
+			description: "Hooks sharing a Done channel should not share values",
+		},
+		{
+			name: "stop",
+			verify: func(t *testing.T, ctx context.Context, cancel context.CancelCauseFunc) {
+				var fired []string
+				stopFirst := OnDone(ctx, func(context.Context, error) { fired = append(fired, "first") })
+				OnDone(ctx, func(context.Context, error) { fired = append(fired, "second") })
+
+				assert.True(t, stopFirst(), "Stopping a pending hook should report true")
+				assert.False(t, stopFirst(), "Stopping twice should report false")
+
+				cancel(nil)
+				synctest.Wait()
+				assert.Equal(t, []string{"second"}, fired)
+			},
+			description: "Stopped hooks should not run",
+		},
+		{
+			name: "stop after run",
+			verify: func(t *testing.T, ctx context.Context, cancel context.CancelCauseFunc) {
+				var fired int
+				stop := OnDone(ctx, func(context.Context, error) { fired++ })
+
+				cancel(nil)
+				synctest.Wait()
+				assert.Equal(t, 1, fired)
+				assert.False(t, stop(), "Stopping a hook that ran should report false")
+			},
+			description: "Stop should report whether the hook was stopped in time",
+		},
+		{
+			name: "already done",
+			verify: func(t *testing.T, ctx context.Context, cancel context.CancelCauseFunc) {
+				cancel(errClient)
+
+				var cause error
+				OnDone(ctx, func(_ context.Context, c error) { cause = c })
+				synctest.Wait()
+				assert.ErrorIs(t, cause, errClient)
+			},
+			description: "Hooks for a done context should run right away",
+		},
+		{
+			name: "timeout",
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelCauseFunc) {
+				timeoutCtx, cancel := ExtendTimeout(ctx, time.Second)
+				defer cancel()
+
+				var cause error
+				OnDone(timeoutCtx, func(_ context.Context, c error) { cause = c })
+				time.Sleep(time.Second)
+				synctest.Wait()
+
+				var timeoutErr *TimeoutError
+				assert.ErrorAs(t, cause, &timeoutErr)
+			},
+			description: "Hooks should get the timeout cause",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				ctx, cancel := context.WithCancelCause(SetTraceID(context.Background(), "trace-done"))
+				defer cancel(nil)
+
+				tc.verify(t, ctx, cancel)
+			})
+		})
+	}
+}
+
+func TestOnDoneNeverDone(t *testing.T) {
+	t.Parallel()
+
+	stop := OnDone(context.Background(), func(context.Context, error) {
+		t.Error("hook should not run")
+	})
+	assert.False(t, stop(), "Hooks for a context that is never done are never pending")
+}
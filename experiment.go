@@ -0,0 +1,150 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// ExperimentOverrideHeader is the header QA can use to force experiment variants.
+// Its value is a comma-separated list of experiment=variant pairs.
+const ExperimentOverrideHeader = "X-Experiment-Override"
+
+// ErrInvalidExperiment is returned by Assign when the variants or weights are unusable.
+var ErrInvalidExperiment = errors.New("ctxutil: invalid experiment")
+
+// ErrNoAssignmentUnit is returned by Assign when the context has neither a
+// device ID nor a trace ID to bucket on, since hashing nothing would put
+// every such request in the same variant.
+var ErrNoAssignmentUnit = errors.New("ctxutil: no device or trace ID to assign on")
+
+// Assign buckets the request into one of the experiment's variants.
+// The bucket is derived from a hash of the device ID, falling back to the trace ID,
+// so the same device always gets the same variant. Without either,
+// Assign fails with ErrNoAssignmentUnit.
+// Weights are relative and must be finite; nil weights split traffic evenly.
+// Overrides set with SetExperimentOverrides win over hashing as long as
+// they name one of the variants.
+// The assignment is recorded in the returned context, see Assignments.
+func Assign(ctx context.Context, experiment string, variants []string, weights []float64) (context.Context, string, error) {
+	if len(variants) == 0 {
+		return ctx, "", ErrInvalidExperiment
+	}
+	if weights == nil {
+		weights = make([]float64, len(variants))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	if len(weights) != len(variants) {
+		return ctx, "", ErrInvalidExperiment
+	}
+
+	var total float64
+	for _, w := range weights {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return ctx, "", ErrInvalidExperiment
+		}
+		total += w
+	}
+	if total == 0 || math.IsInf(total, 0) {
+		return ctx, "", ErrInvalidExperiment
+	}
+
+	vals := getValues(ctx)
+
+	vals.mu.Lock()
+	forced, hasOverride := vals.overrides[experiment]
+	unit := vals.deviceID
+	if unit == "" {
+		unit = vals.traceID
+	}
+	vals.mu.Unlock()
+
+	var variant string
+	if hasOverride && slices.Contains(variants, forced) {
+		variant = forced
+	} else if unit == "" {
+		return ctx, "", ErrNoAssignmentUnit
+	} else {
+		point := bucket(experiment, unit) * total
+		for i, w := range weights {
+			point -= w
+			if point < 0 {
+				variant = variants[i]
+				break
+			}
+		}
+		if variant == "" {
+			// rounding left the point at the very end of the range
+			variant = variants[len(variants)-1]
+		}
+	}
+
+	ctx = update(ctx, func(v *contextValues) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		if v.assignments == nil {
+			v.assignments = make(map[string]string)
+		}
+		v.assignments[experiment] = variant
+	})
+	return ctx, variant, nil
+}
+
+// Assignments returns a copy of the experiment assignments recorded in the context.
+func Assignments(ctx context.Context) map[string]string {
+	vals := getValues(ctx)
+
+	vals.mu.Lock()
+	defer vals.mu.Unlock()
+
+	return maps.Clone(vals.assignments)
+}
+
+// SetExperimentOverrides parses the value of ExperimentOverrideHeader
+// and stores the forced variants in the context.
+// Malformed pairs are ignored.
+func SetExperimentOverrides(ctx context.Context, header string) context.Context {
+	return update(ctx, func(v *contextValues) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		for pair := range strings.SplitSeq(header, ",") {
+			experiment, variant, ok := strings.Cut(pair, "=")
+			experiment, variant = strings.TrimSpace(experiment), strings.TrimSpace(variant)
+			if !ok || experiment == "" || variant == "" {
+				continue
+			}
+			if v.overrides == nil {
+				v.overrides = make(map[string]string)
+			}
+			v.overrides[experiment] = variant
+		}
+	})
+}
+
+// bucket hashes the experiment and unit into a point in [0, 1).
+func bucket(experiment, unit string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(experiment))
+	h.Write([]byte{0})
+	h.Write([]byte(unit))
+	return float64(mix64(h.Sum64())>>11) / (1 << 53)
+}
+
+// mix64 spreads the bits of x. FNV alone barely moves the high bits
+// for inputs that differ only in their last bytes.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,208 @@
+package ctxutil
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssign(t *testing.T) {
+	t.Parallel()
+
+	variants := []string{"control", "treatment"}
+
+	testCases := []struct {
+		name        string
+		setupCtx    func() context.Context
+		variants    []string
+		weights     []float64
+		expectedErr error
+		verify      func(*testing.T, context.Context, string)
+		description string
+	}{
+		{
+			name:        "no variants",
+			setupCtx:    func() context.Context { return context.Background() },
+			variants:    nil,
+			expectedErr: ErrInvalidExperiment,
+			description: "Assigning without variants should fail",
+		},
+		{
+			name:        "mismatched weights",
+			setupCtx:    func() context.Context { return context.Background() },
+			variants:    variants,
+			weights:     []float64{1},
+			expectedErr: ErrInvalidExperiment,
+			description: "Weights must match the variants",
+		},
+		{
+			name:        "zero total weight",
+			setupCtx:    func() context.Context { return context.Background() },
+			variants:    variants,
+			weights:     []float64{0, 0},
+			expectedErr: ErrInvalidExperiment,
+			description: "At least one variant must have weight",
+		},
+		{
+			name:        "negative weight",
+			setupCtx:    func() context.Context { return context.Background() },
+			variants:    variants,
+			weights:     []float64{-1, 2},
+			expectedErr: ErrInvalidExperiment,
+			description: "Negative weights are invalid",
+		},
+		{
+			name:        "NaN weight",
+			setupCtx:    func() context.Context { return SetDeviceID(context.Background(), "device-123") },
+			variants:    variants,
+			weights:     []float64{math.NaN(), 1},
+			expectedErr: ErrInvalidExperiment,
+			description: "NaN weights are invalid",
+		},
+		{
+			name:        "infinite weight",
+			setupCtx:    func() context.Context { return SetDeviceID(context.Background(), "device-123") },
+			variants:    variants,
+			weights:     []float64{1, math.Inf(1)},
+			expectedErr: ErrInvalidExperiment,
+			description: "Infinite weights are invalid",
+		},
+		{
+			name:        "overflowing total weight",
+			setupCtx:    func() context.Context { return SetDeviceID(context.Background(), "device-123") },
+			variants:    variants,
+			weights:     []float64{math.MaxFloat64, math.MaxFloat64},
+			expectedErr: ErrInvalidExperiment,
+			description: "Weights must add up to a finite total",
+		},
+		{
+			name: "all traffic to one variant",
+			setupCtx: func() context.Context {
+				return SetDeviceID(context.Background(), "device-123")
+			},
+			variants: variants,
+			weights:  []float64{0, 1},
+			verify: func(t *testing.T, _ context.Context, variant string) {
+				assert.Equal(t, "treatment", variant)
+			},
+			description: "A variant with all the weight should always win",
+		},
+		{
+			name: "assignment is recorded",
+			setupCtx: func() context.Context {
+				return SetDeviceID(context.Background(), "device-123")
+			},
+			variants: variants,
+			verify: func(t *testing.T, ctx context.Context, variant string) {
+				assert.Equal(t, map[string]string{"checkout": variant}, Assignments(ctx))
+			},
+			description: "Assignments should be visible for logging",
+		},
+		{
+			name: "override wins",
+			setupCtx: func() context.Context {
+				ctx := SetDeviceID(context.Background(), "device-123")
+				return SetExperimentOverrides(ctx, "other=x, checkout=treatment")
+			},
+			variants: variants,
+			weights:  []float64{1, 0},
+			verify: func(t *testing.T, _ context.Context, variant string) {
+				assert.Equal(t, "treatment", variant)
+			},
+			description: "QA overrides should force the variant",
+		},
+		{
+			name: "unknown override variant is ignored",
+			setupCtx: func() context.Context {
+				ctx := SetDeviceID(context.Background(), "device-123")
+				return SetExperimentOverrides(ctx, "checkout=bogus")
+			},
+			variants: variants,
+			weights:  []float64{1, 0},
+			verify: func(t *testing.T, _ context.Context, variant string) {
+				assert.Equal(t, "control", variant)
+			},
+			description: "Overrides naming unknown variants should fall back to hashing",
+		},
+		{
+			name:        "no device or trace ID",
+			setupCtx:    func() context.Context { return context.Background() },
+			variants:    variants,
+			expectedErr: ErrNoAssignmentUnit,
+			description: "Anonymous requests should not all land in one variant",
+		},
+		{
+			name: "trace ID fallback",
+			setupCtx: func() context.Context {
+				return SetTraceID(context.Background(), "trace-123")
+			},
+			variants: variants,
+			weights:  []float64{0, 1},
+			verify: func(t *testing.T, _ context.Context, variant string) {
+				assert.Equal(t, "treatment", variant)
+			},
+			description: "The trace ID should be used without a device ID",
+		},
+		{
+			name: "override without IDs",
+			setupCtx: func() context.Context {
+				return SetExperimentOverrides(context.Background(), "checkout=treatment")
+			},
+			variants: variants,
+			verify: func(t *testing.T, _ context.Context, variant string) {
+				assert.Equal(t, "treatment", variant)
+			},
+			description: "QA overrides should not need an assignment unit",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, variant, err := Assign(tc.setupCtx(), "checkout", tc.variants, tc.weights)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr, tc.description)
+				return
+			}
+			require.NoError(t, err, tc.description)
+			tc.verify(t, ctx, variant)
+		})
+	}
+}
+
+func TestAssignIsDeterministic(t *testing.T) {
+	t.Parallel()
+
+	variants := []string{"a", "b", "c"}
+	counts := make(map[string]int)
+
+	for i := range 3000 {
+		deviceID := fmt.Sprintf("device-%d", i)
+
+		_, first, err := Assign(SetDeviceID(context.Background(), deviceID), "exp", variants, nil)
+		require.NoError(t, err)
+		_, second, err := Assign(SetDeviceID(context.Background(), deviceID), "exp", variants, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, first, second, "Same device should always get the same variant")
+		counts[first]++
+	}
+
+	// even weights should spread devices roughly evenly
+	for _, v := range variants {
+		assert.InDelta(t, 1000, counts[v], 150, "Variant %s should get about a third of devices", v)
+	}
+
+	// the trace ID is used when there's no device ID
+	ctx := SetTraceID(context.Background(), "device-42")
+	_, byTrace, err := Assign(ctx, "exp", variants, nil)
+	require.NoError(t, err)
+	_, byDevice, err := Assign(SetDeviceID(context.Background(), "device-42"), "exp", variants, nil)
+	require.NoError(t, err)
+	assert.Equal(t, byDevice, byTrace, "Trace ID should be used as a fallback bucketing unit")
+}
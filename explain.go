@@ -0,0 +1,77 @@
+package ctxutil
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// DeadlineSource is a deadline applied by one of the package's constructors.
+type DeadlineSource struct {
+	Label     string // set with WithLabel
+	Operation string // constructor that applied the deadline, empty if set outside the package
+	Deadline  time.Time
+	Binding   bool // whether it's the context's effective deadline
+}
+
+type deadlineKey struct{}
+
+// deadlineNode is a deadline source in a context chain, linked to the ones
+// applied before it. The deadline is read when explaining, since some
+// constructors move it after creation; it's zero while there is none.
+type deadlineNode struct {
+	label     string
+	operation string
+	deadline  func() time.Time
+	prev      *deadlineNode
+}
+
+// recordDeadline records a deadline source on top of the ones of ctx.
+func recordDeadline(ctx context.Context, label, operation string, deadline func() time.Time) context.Context {
+	return context.WithValue(ctx, deadlineKey{}, &deadlineNode{
+		label:     label,
+		operation: operation,
+		deadline:  deadline,
+		prev:      deadlineChain(ctx),
+	})
+}
+
+// deadlineChain returns the latest deadline source recorded in ctx.
+func deadlineChain(ctx context.Context) *deadlineNode {
+	n, _ := ctx.Value(deadlineKey{}).(*deadlineNode)
+	return n
+}
+
+// ExplainDeadline lists the deadlines applied to the context chain by the
+// package's constructors, oldest first, marking the one that sets the
+// context's effective deadline as binding. Deadlines replaced by a detached
+// context, such as one created by ExtendTimeout, are listed too.
+// If the effective deadline was set outside the package, for instance by
+// the client, it's listed first with an empty Operation.
+func ExplainDeadline(ctx context.Context) []DeadlineSource {
+	var sources []DeadlineSource
+	for n := deadlineChain(ctx); n != nil; n = n.prev {
+		deadline := n.deadline()
+		if deadline.IsZero() {
+			continue
+		}
+		sources = append(sources, DeadlineSource{
+			Label:     n.label,
+			Operation: n.operation,
+			Deadline:  deadline,
+		})
+	}
+	slices.Reverse(sources)
+
+	effective, ok := ctx.Deadline()
+	if !ok {
+		return sources
+	}
+	for i := len(sources) - 1; i >= 0; i-- {
+		if sources[i].Deadline.Equal(effective) {
+			sources[i].Binding = true
+			return sources
+		}
+	}
+	return append([]DeadlineSource{{Deadline: effective, Binding: true}}, sources...)
+}
@@ -0,0 +1,119 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainDeadline(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, time.Time)
+		description string
+	}{
+		{
+			name: "no deadline",
+			verify: func(t *testing.T, _ time.Time) {
+				assert.Empty(t, ExplainDeadline(context.Background()))
+			},
+			description: "Contexts without deadline have nothing to explain",
+		},
+		{
+			name: "external deadline",
+			verify: func(t *testing.T, now time.Time) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				assert.Equal(t, []DeadlineSource{
+					{Deadline: now.Add(time.Second), Binding: true},
+				}, ExplainDeadline(ctx))
+			},
+			description: "Deadlines set outside the package have no operation",
+		},
+		{
+			name: "chain of helpers",
+			verify: func(t *testing.T, now time.Time) {
+				clientCtx, cancelClient := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancelClient()
+
+				ctx, cancel := ExtendTimeout(clientCtx, 5*time.Second, WithLabel("handler"))
+				defer cancel()
+
+				ctx, cancelDB := Reserve(ctx, time.Second, WithLabel("db"))
+				defer cancelDB()
+
+				ctx, cancelCache := FloorTimeout(ctx, time.Second)
+				defer cancelCache()
+
+				assert.Equal(t, []DeadlineSource{
+					{Label: "handler", Operation: "ExtendTimeout", Deadline: now.Add(5 * time.Second)},
+					{Label: "db", Operation: "Reserve", Deadline: now.Add(4 * time.Second)},
+					{Operation: "FloorTimeout", Deadline: now.Add(4 * time.Second), Binding: true},
+				}, ExplainDeadline(ctx), "Sources should be listed oldest first, the latest matching one binding")
+			},
+			description: "Every helper should record its deadline",
+		},
+		{
+			name: "earlier parent deadline is binding",
+			verify: func(t *testing.T, now time.Time) {
+				parentCtx, cancelParent := ExtendTimeout(context.Background(), time.Second, WithLabel("client"))
+				defer cancelParent()
+
+				ctx, cancel := context.WithTimeout(parentCtx, time.Minute)
+				defer cancel()
+
+				assert.Equal(t, []DeadlineSource{
+					{Label: "client", Operation: "ExtendTimeout", Deadline: now.Add(time.Second), Binding: true},
+				}, ExplainDeadline(ctx))
+			},
+			description: "The parent's deadline should be binding when it comes first",
+		},
+		{
+			name: "moved deadline",
+			verify: func(t *testing.T, now time.Time) {
+				ctx, renew, cancel := WithLease(context.Background(), 10*time.Second, WithLabel("job"))
+				defer cancel()
+
+				time.Sleep(5 * time.Second)
+				renew()
+
+				assert.Equal(t, []DeadlineSource{
+					{Label: "job", Operation: "WithLease", Deadline: now.Add(15 * time.Second), Binding: true},
+				}, ExplainDeadline(ctx), "Renewed deadline should be reported")
+			},
+			description: "Deadlines moved after creation should be reported as they are now",
+		},
+		{
+			name: "siblings do not see each other",
+			verify: func(t *testing.T, now time.Time) {
+				ctx := SetTraceID(context.Background(), "trace-explain")
+
+				first, cancelFirst := ExtendTimeout(ctx, time.Second, WithLabel("first"))
+				defer cancelFirst()
+				_, cancelSecond := ExtendTimeout(ctx, time.Minute, WithLabel("second"))
+				defer cancelSecond()
+
+				assert.Equal(t, []DeadlineSource{
+					{Label: "first", Operation: "ExtendTimeout", Deadline: now.Add(time.Second), Binding: true},
+				}, ExplainDeadline(first))
+			},
+			description: "Sources should be recorded per context chain",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				tc.verify(t, time.Now())
+			})
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package ctxutil
+
+import (
+	"context"
+	"sync"
+)
+
+// FlagValue is the set of types a feature flag can evaluate to.
+type FlagValue interface {
+	bool | string
+}
+
+// FlagProvider evaluates feature flags for a device.
+// It is called at most once per device ID per request, the first time
+// a flag is looked up that wasn't set explicitly with SetFlags.
+// It's called without holding any lock on the context's values, so it can
+// use the package's helpers, such as CapTimeout, on the context it is given.
+type FlagProvider interface {
+	EvaluateFlags(ctx context.Context, deviceID string) map[string]any
+}
+
+// FlagProviderFunc adapts an ordinary function to the FlagProvider interface.
+type FlagProviderFunc func(ctx context.Context, deviceID string) map[string]any
+
+// EvaluateFlags calls f(ctx, deviceID).
+func (f FlagProviderFunc) EvaluateFlags(ctx context.Context, deviceID string) map[string]any {
+	return f(ctx, deviceID)
+}
+
+// SetFlags stores a snapshot of flag decisions in the context.
+// Flags already in the context are kept unless overridden by name.
+func SetFlags[V FlagValue](ctx context.Context, flags map[string]V) context.Context {
+	return update(ctx, func(v *contextValues) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		if v.flags == nil {
+			v.flags = make(map[string]any, len(flags))
+		}
+		for name, value := range flags {
+			v.flags[name] = value
+		}
+	})
+}
+
+// WithFlagProvider sets the provider used to lazily evaluate
+// flags that weren't set explicitly with SetFlags.
+func WithFlagProvider(ctx context.Context, provider FlagProvider) context.Context {
+	return update(ctx, func(v *contextValues) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		v.flagProvider = provider
+		v.flagCache = nil
+	})
+}
+
+// Flag gets the value of a feature flag from the context.
+// Explicitly set flags take precedence over the provider.
+// The result is cached in the context keyed by the current device ID,
+// so every component handling the request sees the same decision.
+// ok is false if the flag is unknown or holds a value of another type.
+func Flag[V FlagValue](ctx context.Context, name string) (V, bool) {
+	var zero V
+
+	raw, found := lookupFlag(ctx, name)
+	if !found {
+		return zero, false
+	}
+	value, ok := raw.(V)
+	if !ok {
+		return zero, false
+	}
+	return value, true
+}
+
+// flagSnapshot is the provider's evaluation for one device,
+// computed once by the first lookup that needs it.
+type flagSnapshot struct {
+	once  sync.Once
+	flags map[string]any
+}
+
+// lookupFlag finds the raw value of a flag, evaluating the provider if needed.
+// The provider is called outside the values lock: concurrent lookups for
+// the same device wait for the first evaluation instead.
+func lookupFlag(ctx context.Context, name string) (any, bool) {
+	vals := getValues(ctx)
+
+	vals.mu.Lock()
+	if value, ok := vals.flags[name]; ok {
+		vals.mu.Unlock()
+		return value, true
+	}
+	provider := vals.flagProvider
+	if provider == nil {
+		vals.mu.Unlock()
+		return nil, false
+	}
+
+	deviceID := vals.deviceID
+	snapshot, ok := vals.flagCache[deviceID]
+	if !ok {
+		snapshot = &flagSnapshot{}
+		if vals.flagCache == nil {
+			vals.flagCache = make(map[string]*flagSnapshot)
+		}
+		vals.flagCache[deviceID] = snapshot
+	}
+	vals.mu.Unlock()
+
+	snapshot.once.Do(func() {
+		snapshot.flags = provider.EvaluateFlags(ctx, deviceID)
+	})
+
+	value, ok := snapshot.flags[name]
+	return value, ok
+}
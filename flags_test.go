@@ -0,0 +1,192 @@
+package ctxutil
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlag(t *testing.T) {
+	t.Parallel()
+
+	provider := FlagProviderFunc(func(_ context.Context, deviceID string) map[string]any {
+		return map[string]any{
+			"new-checkout": deviceID == "device-beta",
+			"theme":        "dark",
+		}
+	})
+
+	testCases := []struct {
+		name        string
+		setupCtx    func() context.Context
+		verify      func(*testing.T, context.Context)
+		description string
+	}{
+		{
+			name:     "unknown flag in empty context",
+			setupCtx: func() context.Context { return context.Background() },
+			verify: func(t *testing.T, ctx context.Context) {
+				value, ok := Flag[bool](ctx, "missing")
+				assert.False(t, ok)
+				assert.False(t, value)
+			},
+			description: "Flags missing from the context should not be found",
+		},
+		{
+			name: "explicit bool and string flags",
+			setupCtx: func() context.Context {
+				ctx := SetFlags(context.Background(), map[string]bool{"new-checkout": true})
+				return SetFlags(ctx, map[string]string{"theme": "light"})
+			},
+			verify: func(t *testing.T, ctx context.Context) {
+				enabled, ok := Flag[bool](ctx, "new-checkout")
+				assert.True(t, ok)
+				assert.True(t, enabled)
+
+				theme, ok := Flag[string](ctx, "theme")
+				assert.True(t, ok)
+				assert.Equal(t, "light", theme)
+			},
+			description: "Flags set with SetFlags should be retrievable by type",
+		},
+		{
+			name: "wrong type is not found",
+			setupCtx: func() context.Context {
+				return SetFlags(context.Background(), map[string]string{"theme": "light"})
+			},
+			verify: func(t *testing.T, ctx context.Context) {
+				_, ok := Flag[bool](ctx, "theme")
+				assert.False(t, ok)
+			},
+			description: "Looking up a flag with the wrong type should fail",
+		},
+		{
+			name: "provider evaluated for device",
+			setupCtx: func() context.Context {
+				ctx := SetDeviceID(context.Background(), "device-beta")
+				return WithFlagProvider(ctx, provider)
+			},
+			verify: func(t *testing.T, ctx context.Context) {
+				enabled, ok := Flag[bool](ctx, "new-checkout")
+				assert.True(t, ok)
+				assert.True(t, enabled)
+			},
+			description: "Provider should be evaluated with the context's device ID",
+		},
+		{
+			name: "explicit flags take precedence over provider",
+			setupCtx: func() context.Context {
+				ctx := WithFlagProvider(context.Background(), provider)
+				return SetFlags(ctx, map[string]string{"theme": "light"})
+			},
+			verify: func(t *testing.T, ctx context.Context) {
+				theme, ok := Flag[string](ctx, "theme")
+				assert.True(t, ok)
+				assert.Equal(t, "light", theme)
+			},
+			description: "Snapshot from the edge should win over the provider",
+		},
+		{
+			name: "derived context sees the same flags",
+			setupCtx: func() context.Context {
+				ctx := SetFlags(context.Background(), map[string]bool{"new-checkout": true})
+				return context.WithValue(ctx, "some-key", "some-value")
+			},
+			verify: func(t *testing.T, ctx context.Context) {
+				enabled, ok := Flag[bool](ctx, "new-checkout")
+				assert.True(t, ok)
+				assert.True(t, enabled)
+			},
+			description: "Child contexts should inherit the flag snapshot",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.verify(t, tc.setupCtx())
+		})
+	}
+}
+
+func TestFlagProviderCaching(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	provider := FlagProviderFunc(func(_ context.Context, deviceID string) map[string]any {
+		calls.Add(1)
+		return map[string]any{"bucket": deviceID}
+	})
+
+	ctx := SetDeviceID(context.Background(), "device-1")
+	ctx = WithFlagProvider(ctx, provider)
+
+	// concurrent lookups within the same request evaluate the provider once
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bucket, ok := Flag[string](ctx, "bucket")
+			assert.True(t, ok)
+			assert.Equal(t, "device-1", bucket)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load(), "Provider should be evaluated once per device")
+
+	// a different device ID gets its own sticky evaluation
+	ctx = SetDeviceID(ctx, "device-2")
+	bucket, ok := Flag[string](ctx, "bucket")
+	assert.True(t, ok)
+	assert.Equal(t, "device-2", bucket)
+	assert.Equal(t, int32(2), calls.Load(), "Provider should be evaluated again for a new device")
+
+	// switching back reuses the cached decision
+	ctx = SetDeviceID(ctx, "device-1")
+	bucket, _ = Flag[string](ctx, "bucket")
+	assert.Equal(t, "device-1", bucket)
+	assert.Equal(t, int32(2), calls.Load(), "Cached decisions should be reused")
+}
+
+func TestFlagProviderUsesHelpers(t *testing.T) {
+	t.Parallel()
+
+	var (
+		hadDeadline bool
+		remaining   time.Duration
+	)
+	provider := FlagProviderFunc(func(ctx context.Context, deviceID string) map[string]any {
+		// a call to the flag service, bounded like any other
+		callCtx, cancel := CapTimeout(ctx, time.Second)
+		defer cancel()
+
+		remaining, hadDeadline = Remaining(callCtx)
+		return map[string]any{"beta": true}
+	})
+
+	ctx := SetDeviceID(context.Background(), "device-1")
+	ctx = WithFlagProvider(ctx, provider)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		enabled, ok := Flag[bool](ctx, "beta")
+		assert.True(t, ok)
+		assert.True(t, enabled)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Flag deadlocked on a provider using the package's helpers")
+	}
+	assert.True(t, hadDeadline)
+	assert.Positive(t, remaining)
+}
@@ -0,0 +1,207 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PanicError is reported to the error handler when a goroutine
+// started with Go panics.
+type PanicError struct {
+	Value    any    // value passed to panic
+	Stack    []byte // stack of the panicking goroutine
+	TraceID  string
+	DeviceID string
+}
+
+func (e *PanicError) Error() string {
+	msg := fmt.Sprintf("ctxutil: panic: %v", e.Value)
+	if e.TraceID != "" {
+		msg += " trace_id=" + e.TraceID
+	}
+	if e.DeviceID != "" {
+		msg += " device_id=" + e.DeviceID
+	}
+	return msg
+}
+
+// Unwrap returns the panic value if it's an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// ErrGroupClosed is reported to the error handler, in place of running
+// the work, when Go is called on a Group whose Wait has already started.
+var ErrGroupClosed = errors.New("ctxutil: group is shutting down")
+
+// ErrorHandler receives the errors of goroutines started with Go,
+// along with their context, which still carries the values.
+type ErrorHandler func(ctx context.Context, err error)
+
+// handlerHolder lets an ErrorHandler live in an atomic.Pointer.
+type handlerHolder struct {
+	handler ErrorHandler
+}
+
+var defaultHandler atomic.Pointer[handlerHolder]
+
+// SetErrorHandler installs the handler for the errors and panics of
+// goroutines started with Go, for groups without their own handler.
+// Passing nil restores the default, which logs them with the log package.
+func SetErrorHandler(handler ErrorHandler) {
+	if handler == nil {
+		defaultHandler.Store(nil)
+		return
+	}
+	defaultHandler.Store(&handlerHolder{handler: handler})
+}
+
+// logError is the default ErrorHandler.
+func logError(_ context.Context, err error) {
+	log.Print(err)
+}
+
+// Group tracks goroutines started with its Go method, so that a graceful
+// shutdown can wait for them. The zero Group is ready to use and reports
+// errors to the handler installed with SetErrorHandler.
+// Once Wait has been called, the Group takes no new work.
+type Group struct {
+	handler ErrorHandler
+
+	mu      sync.Mutex
+	running int
+	idle    chan struct{} // closed once running drops to zero
+	closed  bool
+}
+
+// NewGroup creates a Group that reports errors to handler.
+func NewGroup(handler ErrorHandler) *Group {
+	return &Group{handler: handler}
+}
+
+// defaultGroup is the Group used by the package-level Go and Wait.
+var defaultGroup Group
+
+// Go runs fn on a new goroutine tracked by the package's group, see Group.Go.
+func Go(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) {
+	defaultGroup.Go(ctx, timeout, fn)
+}
+
+// Wait waits for the goroutines started with the package-level Go, see
+// Group.Wait. Unlike Group.Wait, it doesn't stop Go from starting new work,
+// so it can be called again, for instance after a shutdown that timed out.
+func Wait(ctx context.Context) error {
+	return defaultGroup.wait(ctx)
+}
+
+// Go runs fn on a new goroutine, for background work that must outlive
+// the request that started it. Like ExtendTimeoutKeepAll, fn's context
+// carries every value of ctx and ignores its deadline and cancellation;
+// it ends after timeout instead, or never if timeout is zero.
+// An error returned by fn, or a panic recovered as a *PanicError,
+// is reported to the group's error handler. So is ErrGroupClosed,
+// without running fn, if Wait has already been called.
+func (g *Group) Go(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) {
+	detached := context.WithoutCancel(ctx)
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		g.report(detached, ErrGroupClosed)
+		return
+	}
+	if g.running == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.running++
+	g.mu.Unlock()
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		detached, cancel = withDeadline(detached, clockFrom(ctx).Now().Add(timeout), "Go", options{})
+	}
+
+	go func() {
+		defer g.finish()
+		defer cancel()
+
+		if err := runRecovered(detached, fn); err != nil {
+			g.report(detached, err)
+		}
+	}()
+}
+
+// Wait blocks until every goroutine started with Go has returned,
+// or until ctx is done, in which case it returns the cause of ctx.
+// From then on, the group rejects new work, see ErrGroupClosed.
+func (g *Group) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	return g.wait(ctx)
+}
+
+// wait blocks until no goroutine is running, or until ctx is done.
+func (g *Group) wait(ctx context.Context) error {
+	g.mu.Lock()
+	idle := g.idle
+	running := g.running
+	g.mu.Unlock()
+
+	if running == 0 {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// finish records that a goroutine started with Go has returned.
+func (g *Group) finish() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.running--
+	if g.running == 0 {
+		close(g.idle)
+	}
+}
+
+// report hands err to the group's handler, or the installed one.
+func (g *Group) report(ctx context.Context, err error) {
+	handler := g.handler
+	if handler == nil {
+		handler = logError
+		if h := defaultHandler.Load(); h != nil {
+			handler = h.handler
+		}
+	}
+	handler(ctx, err)
+}
+
+// runRecovered calls fn, recovering a panic into a *PanicError.
+func runRecovered(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			vals := getValues(ctx)
+			err = &PanicError{
+				Value:    v,
+				Stack:    debug.Stack(),
+				TraceID:  vals.traceID,
+				DeviceID: vals.deviceID,
+			}
+		}
+	}()
+	return fn(ctx)
+}
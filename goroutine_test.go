@@ -0,0 +1,223 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reported collects the errors handed to an ErrorHandler.
+type reported struct {
+	mu       sync.Mutex
+	errs     []error
+	traceIDs []string
+}
+
+func (r *reported) handle(ctx context.Context, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errs = append(r.errs, err)
+	r.traceIDs = append(r.traceIDs, GetTraceID(ctx))
+}
+
+func TestGroupGo(t *testing.T) {
+	t.Parallel()
+
+	type foreignKey struct{}
+
+	errFailed := errors.New("sync failed")
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, context.Context, context.CancelFunc, *Group, *reported)
+		description string
+	}{
+		{
+			name: "outlives the request",
+			verify: func(t *testing.T, ctx context.Context, cancelRequest context.CancelFunc, g *Group, r *reported) {
+				var (
+					err     error
+					foreign any
+					traceID string
+				)
+				g.Go(ctx, time.Minute, func(ctx context.Context) error {
+					cancelRequest()
+					time.Sleep(time.Second)
+					err, foreign, traceID = ctx.Err(), ctx.Value(foreignKey{}), GetTraceID(ctx)
+					return nil
+				})
+
+				require.NoError(t, g.Wait(context.Background()))
+				assert.NoError(t, err, "Work should survive the request's cancellation")
+				assert.Equal(t, "audit", foreign, "Foreign values should be preserved")
+				assert.Equal(t, "trace-go", traceID)
+				assert.Empty(t, r.errs)
+			},
+			description: "Background work should be detached but keep the values",
+		},
+		{
+			name: "timeout",
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc, g *Group, r *reported) {
+				g.Go(ctx, time.Second, func(ctx context.Context) error {
+					<-ctx.Done()
+					return context.Cause(ctx)
+				})
+
+				require.NoError(t, g.Wait(context.Background()))
+				require.Len(t, r.errs, 1)
+
+				var timeoutErr *TimeoutError
+				require.ErrorAs(t, r.errs[0], &timeoutErr)
+				assert.Equal(t, "Go", timeoutErr.Operation)
+			},
+			description: "Background work should end after its timeout",
+		},
+		{
+			name: "no timeout",
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc, g *Group, _ *reported) {
+				var hasDeadline bool
+				g.Go(ctx, 0, func(ctx context.Context) error {
+					_, hasDeadline = ctx.Deadline()
+					return nil
+				})
+
+				require.NoError(t, g.Wait(context.Background()))
+				assert.False(t, hasDeadline, "Zero timeout should mean no deadline")
+			},
+			description: "A zero timeout should not end the work",
+		},
+		{
+			name: "returned error",
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc, g *Group, r *reported) {
+				g.Go(ctx, time.Minute, func(context.Context) error { return errFailed })
+
+				require.NoError(t, g.Wait(context.Background()))
+				require.Len(t, r.errs, 1)
+				assert.ErrorIs(t, r.errs[0], errFailed)
+				assert.Equal(t, []string{"trace-go"}, r.traceIDs, "Handler should get the work's context")
+			},
+			description: "Errors should be reported to the handler",
+		},
+		{
+			name: "panic",
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc, g *Group, r *reported) {
+				g.Go(ctx, time.Minute, func(context.Context) error { panic(errFailed) })
+				g.Go(ctx, time.Minute, func(context.Context) error { panic("boom") })
+
+				require.NoError(t, g.Wait(context.Background()))
+				require.Len(t, r.errs, 2)
+
+				for _, err := range r.errs {
+					var panicErr *PanicError
+					require.ErrorAs(t, err, &panicErr)
+					assert.Equal(t, "trace-go", panicErr.TraceID)
+					assert.Equal(t, "device-go", panicErr.DeviceID)
+					assert.Contains(t, string(panicErr.Stack), "TestGroupGo", "Stack should lead to the panic")
+
+					if panicErr.Value == "boom" {
+						assert.Equal(t, "ctxutil: panic: boom trace_id=trace-go device_id=device-go", panicErr.Error())
+					} else {
+						assert.ErrorIs(t, err, errFailed, "Error panics should be unwrapped")
+					}
+				}
+			},
+			description: "Panics should be recovered and reported with the IDs",
+		},
+		{
+			name: "wait gives up with its context",
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc, g *Group, _ *reported) {
+				g.Go(ctx, time.Minute, func(ctx context.Context) error {
+					time.Sleep(10 * time.Second)
+					return nil
+				})
+
+				waitCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				assert.ErrorIs(t, g.Wait(waitCtx), context.DeadlineExceeded, "Shutdown should not wait forever")
+
+				assert.NoError(t, g.Wait(context.Background()))
+			},
+			description: "Wait should respect the shutdown deadline",
+		},
+		{
+			name: "no new work after wait",
+			verify: func(t *testing.T, ctx context.Context, _ context.CancelFunc, g *Group, r *reported) {
+				var ran bool
+				g.Go(ctx, time.Minute, func(ctx context.Context) error {
+					time.Sleep(time.Second)
+					return nil
+				})
+
+				waited := make(chan error)
+				go func() { waited <- g.Wait(context.Background()) }()
+				synctest.Wait()
+
+				g.Go(ctx, time.Minute, func(context.Context) error {
+					ran = true
+					return nil
+				})
+				require.NoError(t, <-waited)
+				synctest.Wait()
+
+				assert.False(t, ran, "Work should not start once Wait has been called")
+				require.Len(t, r.errs, 1)
+				assert.ErrorIs(t, r.errs[0], ErrGroupClosed)
+				assert.Equal(t, []string{"trace-go"}, r.traceIDs, "Handler should get the work's context")
+			},
+			description: "A group should reject work once shutting down",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				ctx = context.WithValue(ctx, foreignKey{}, "audit")
+				ctx = SetTraceID(ctx, "trace-go")
+				ctx = SetDeviceID(ctx, "device-go")
+
+				r := &reported{}
+				tc.verify(t, ctx, cancel, NewGroup(r.handle), r)
+			})
+		})
+	}
+}
+
+// not parallel: swaps the package error handler
+func TestGo(t *testing.T) {
+	t.Cleanup(func() { SetErrorHandler(nil) })
+
+	r := &reported{}
+	SetErrorHandler(r.handle)
+
+	Go(SetTraceID(context.Background(), "trace-default"), time.Minute, func(context.Context) error {
+		panic("boom")
+	})
+	require.NoError(t, Wait(context.Background()))
+
+	require.Len(t, r.errs, 1)
+	assert.Equal(t, []string{"trace-default"}, r.traceIDs)
+
+	var panicErr *PanicError
+	assert.ErrorAs(t, r.errs[0], &panicErr)
+
+	// the package's group stays usable after Wait
+	var ran bool
+	Go(context.Background(), time.Minute, func(context.Context) error {
+		ran = true
+		return nil
+	})
+	require.NoError(t, Wait(context.Background()))
+	assert.True(t, ran, "Package-level Go should keep working after Wait")
+	assert.Len(t, r.errs, 1)
+}
@@ -0,0 +1,27 @@
+package ctxutil
+
+import (
+	"context"
+	"time"
+)
+
+// AfterCancel creates a context for cleanup work that must outlive the
+// original context, such as writing an audit record for a canceled request.
+// The new context carries over every value of the original context and
+// ignores its cancellation; instead, a grace period starts the moment the
+// original context is done, and the new context ends when it runs out.
+// Deadline reports nothing until the grace period has started.
+func AfterCancel(ctx context.Context, grace time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	o := newOptions(opts)
+	clock := clockFrom(ctx)
+	c := newRecordedTimerCtx(context.WithoutCancel(ctx), o.label, "AfterCancel", o.timeoutCause(ctx, "AfterCancel", grace), clock)
+
+	stop := context.AfterFunc(ctx, func() {
+		c.setDeadline(clock.Now().Add(grace))
+	})
+
+	return c, track("AfterCancel", func() {
+		stop()
+		c.cancel(context.Canceled)
+	})
+}
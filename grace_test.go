@@ -0,0 +1,104 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAfterCancel(t *testing.T) {
+	t.Parallel()
+
+	type foreignKey struct{}
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, context.Context, context.CancelFunc, context.CancelFunc)
+		description string
+	}{
+		{
+			name: "values are preserved",
+			verify: func(t *testing.T, ctx context.Context, _, _ context.CancelFunc) {
+				assert.Equal(t, "trace-grace", GetTraceID(ctx), "Trace ID should be preserved")
+				assert.Equal(t, "audit-logger", ctx.Value(foreignKey{}), "Foreign values should be preserved")
+			},
+			description: "Cleanup needs every value of the request",
+		},
+		{
+			name: "grace period starts only once parent is done",
+			verify: func(t *testing.T, ctx context.Context, cancelParent, _ context.CancelFunc) {
+				_, ok := ctx.Deadline()
+				assert.False(t, ok, "No deadline before the parent is done")
+
+				// long-lived parent: the grace period hasn't started yet
+				time.Sleep(time.Hour)
+				synctest.Wait()
+				assert.NoError(t, ctx.Err())
+
+				cancelParent()
+				synctest.Wait()
+				assert.NoError(t, ctx.Err(), "Cleanup context should survive parent cancellation")
+
+				deadline, ok := ctx.Deadline()
+				assert.True(t, ok)
+				assert.Equal(t, 5*time.Second, time.Until(deadline), "Grace period is measured from cancellation")
+
+				time.Sleep(5 * time.Second)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+				var timeoutErr *TimeoutError
+				require.ErrorAs(t, context.Cause(ctx), &timeoutErr)
+				assert.Equal(t, "AfterCancel", timeoutErr.Operation)
+				assert.Equal(t, "trace-grace", timeoutErr.TraceID)
+			},
+			description: "The grace period should be measured from cancellation",
+		},
+		{
+			name: "cancel before parent is done",
+			verify: func(t *testing.T, ctx context.Context, cancelParent, cancel context.CancelFunc) {
+				cancel()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+				cancelParent()
+				time.Sleep(10 * time.Second)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled, "Grace period should not start after cancel")
+			},
+			description: "Cancel should end the cleanup context right away",
+		},
+		{
+			name: "cancel during grace period",
+			verify: func(t *testing.T, ctx context.Context, cancelParent, cancel context.CancelFunc) {
+				cancelParent()
+				time.Sleep(time.Second)
+				cancel()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+				assert.ErrorIs(t, context.Cause(ctx), context.Canceled)
+			},
+			description: "Cancel should end the grace period early",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				parentCtx, cancelParent := context.WithCancel(context.Background())
+				defer cancelParent()
+				parentCtx = context.WithValue(parentCtx, foreignKey{}, "audit-logger")
+				parentCtx = SetTraceID(parentCtx, "trace-grace")
+
+				ctx, cancel := AfterCancel(parentCtx, 5*time.Second)
+				defer cancel()
+
+				tc.verify(t, ctx, cancelParent, cancel)
+			})
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrHedgeLost is the cancellation cause of the Hedge attempts
+// that were still running when another one succeeded.
+var ErrHedgeLost = errors.New("ctxutil: another hedged attempt won")
+
+// Hedge calls fn and, if it hasn't answered within delay, calls it again,
+// up to maxHedges extra times, returning the first success. An attempt
+// that fails starts the next one right away. Once an attempt succeeds,
+// the ones still running are canceled with ErrHedgeLost as their cause.
+// If every attempt fails, Hedge returns their errors joined; if ctx is
+// done first, it returns its cause.
+// Each attempt runs in a child context of ctx, so values are preserved,
+// and its number is available to fn through Attempt.
+// Delays use the context's clock.
+func Hedge[T any](ctx context.Context, delay time.Duration, maxHedges int, fn func(context.Context) (T, error)) (T, error) {
+	type result struct {
+		val     T
+		err     error
+		attempt int
+	}
+
+	total := max(maxHedges, 0) + 1
+	results := make(chan result, total)
+	cancels := make([]context.CancelCauseFunc, 0, total)
+	winner := 0
+
+	defer func() {
+		for i, cancel := range cancels {
+			if i+1 == winner {
+				cancel(context.Canceled)
+			} else {
+				cancel(ErrHedgeLost)
+			}
+		}
+	}()
+
+	launch := func() {
+		attempt := len(cancels) + 1
+		attemptCtx, cancel := context.WithCancelCause(context.WithValue(ctx, attemptKey{}, attempt))
+		cancels = append(cancels, cancel)
+
+		go func() {
+			val, err := fn(attemptCtx)
+			results <- result{val: val, err: err, attempt: attempt}
+		}()
+	}
+
+	timer := clockFrom(ctx).NewTimer(delay)
+	defer timer.Stop()
+
+	launch()
+	pending := 1
+
+	var (
+		zero T
+		errs []error
+	)
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				winner = r.attempt
+				return r.val, nil
+			}
+			errs = append(errs, r.err)
+
+			if len(cancels) < total {
+				// don't wait out the delay after a failure
+				if !timer.Stop() {
+					select {
+					case <-timer.C():
+					default:
+					}
+				}
+				launch()
+				pending++
+				timer.Reset(delay)
+			} else if pending == 0 {
+				return zero, errors.Join(errs...)
+			}
+
+		case <-timer.C():
+			if len(cancels) < total {
+				launch()
+				pending++
+				timer.Reset(delay)
+			}
+
+		case <-ctx.Done():
+			return zero, context.Cause(ctx)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedge(t *testing.T) {
+	t.Parallel()
+
+	errUnavailable := errors.New("replica unavailable")
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, context.Context)
+		description string
+	}{
+		{
+			name: "fast first attempt",
+			verify: func(t *testing.T, ctx context.Context) {
+				var calls int
+				val, err := Hedge(ctx, time.Second, 2, func(ctx context.Context) (string, error) {
+					calls++
+					time.Sleep(100 * time.Millisecond)
+					return "primary", nil
+				})
+
+				assert.NoError(t, err)
+				assert.Equal(t, "primary", val)
+				assert.Equal(t, 1, calls, "No hedge should be sent before the delay")
+			},
+			description: "Fast answers should not be hedged",
+		},
+		{
+			name: "hedge wins",
+			verify: func(t *testing.T, ctx context.Context) {
+				var (
+					mu     sync.Mutex
+					causes = make(map[int]error)
+					seen   = make(map[int]string)
+				)
+				start := time.Now()
+				val, err := Hedge(ctx, 100*time.Millisecond, 2, func(ctx context.Context) (int, error) {
+					attempt := Attempt(ctx)
+					mu.Lock()
+					seen[attempt] = GetTraceID(ctx)
+					mu.Unlock()
+
+					if attempt == 1 {
+						// slow primary
+						<-ctx.Done()
+						mu.Lock()
+						causes[attempt] = context.Cause(ctx)
+						mu.Unlock()
+						return 0, ctx.Err()
+					}
+					time.Sleep(50 * time.Millisecond)
+					return attempt, nil
+				})
+				synctest.Wait()
+
+				assert.NoError(t, err)
+				assert.Equal(t, 2, val, "First hedge should win")
+				assert.Equal(t, 150*time.Millisecond, time.Since(start))
+				assert.Equal(t, map[int]string{1: "trace-hedge", 2: "trace-hedge"}, seen, "Attempts should see values and their number")
+				assert.ErrorIs(t, causes[1], ErrHedgeLost, "Loser should be canceled with ErrHedgeLost")
+			},
+			description: "A hedge should answer for a slow primary",
+		},
+		{
+			name: "failure starts next attempt right away",
+			verify: func(t *testing.T, ctx context.Context) {
+				start := time.Now()
+				val, err := Hedge(ctx, time.Hour, 1, func(ctx context.Context) (int, error) {
+					if Attempt(ctx) == 1 {
+						return 0, errUnavailable
+					}
+					return 2, nil
+				})
+
+				assert.NoError(t, err)
+				assert.Equal(t, 2, val)
+				assert.Zero(t, time.Since(start), "Failures should not wait for the delay")
+			},
+			description: "Failed attempts should be replaced immediately",
+		},
+		{
+			name: "all attempts fail",
+			verify: func(t *testing.T, ctx context.Context) {
+				var calls int
+				_, err := Hedge(ctx, time.Second, 2, func(context.Context) (int, error) {
+					calls++
+					return 0, errUnavailable
+				})
+
+				assert.ErrorIs(t, err, errUnavailable)
+				assert.Equal(t, 3, calls, "Primary and every hedge should be tried")
+			},
+			description: "Hedge should report the errors when nothing succeeds",
+		},
+		{
+			name: "context done",
+			verify: func(t *testing.T, ctx context.Context) {
+				ctx, cancel := context.WithTimeout(ctx, time.Second)
+				defer cancel()
+
+				_, err := Hedge(ctx, 100*time.Millisecond, 1, func(ctx context.Context) (int, error) {
+					<-ctx.Done()
+					return 0, ctx.Err()
+				})
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+			},
+			description: "Hedge should give up when the context is done",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				tc.verify(t, SetTraceID(context.Background(), "trace-hedge"))
+			})
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package ctxutil
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// sourceHolder lets a rand.Source interface live in an atomic.Pointer.
+type sourceHolder struct {
+	src rand.Source
+}
+
+var randSource atomic.Pointer[sourceHolder]
+
+// SetRandSource replaces the random source used to generate IDs.
+// The source must be safe for concurrent use.
+// Passing nil restores the default lock-free source.
+func SetRandSource(src rand.Source) {
+	if src == nil {
+		randSource.Store(nil)
+		return
+	}
+	randSource.Store(&sourceHolder{src: src})
+}
+
+// NewTraceID returns a W3C Trace Context trace ID:
+// 16 random bytes encoded as 32 lowercase hex characters, never all zeros.
+func NewTraceID() string {
+	var b [16]byte
+	for isZero(b[:]) {
+		fillRandom(b[:])
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// NewSpanID returns a W3C Trace Context span (parent) ID:
+// 8 random bytes encoded as 16 lowercase hex characters, never all zeros.
+func NewSpanID() string {
+	var b [8]byte
+	for isZero(b[:]) {
+		fillRandom(b[:])
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// EnsureTraceID sets a new trace ID in the context if it doesn't have one yet.
+// The ID comes from the context's generator, see WithIDGenerator.
+func EnsureTraceID(ctx context.Context) context.Context {
+	if GetTraceID(ctx) != "" {
+		return ctx
+	}
+	return SetTraceID(ctx, newID(ctx))
+}
+
+// EnsureRequestID sets a new request ID in the context if it doesn't have one yet.
+// The ID comes from the context's generator, see WithIDGenerator.
+func EnsureRequestID(ctx context.Context) context.Context {
+	if GetRequestID(ctx) != "" {
+		return ctx
+	}
+	return SetRequestID(ctx, newID(ctx))
+}
+
+// randomUint64 returns the next value from the configured random source.
+// By default it reads from the runtime's per-thread ChaCha8 generator,
+// which needs no locking and scales with the number of CPUs.
+func randomUint64() uint64 {
+	if h := randSource.Load(); h != nil {
+		return h.src.Uint64()
+	}
+	return rand.Uint64()
+}
+
+// fillRandom fills b with bytes from the configured random source.
+func fillRandom(b []byte) {
+	var buf [8]byte
+	for len(b) > 0 {
+		binary.BigEndian.PutUint64(buf[:], randomUint64())
+		b = b[copy(b, buf[:]):]
+	}
+}
+
+// isZero reports whether every byte of b is zero.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
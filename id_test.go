@@ -0,0 +1,135 @@
+package ctxutil
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	traceIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	spanIDPattern  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// sequenceSource replays a fixed sequence of values, then keeps returning the last one.
+type sequenceSource struct {
+	vals []uint64
+	next atomic.Int64
+}
+
+func (s *sequenceSource) Uint64() uint64 {
+	i := min(int(s.next.Add(1)-1), len(s.vals)-1)
+	return s.vals[i]
+}
+
+func TestNewTraceID(t *testing.T) {
+	t.Parallel()
+
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := NewTraceID()
+		assert.Regexp(t, traceIDPattern, id, "Trace ID should be 32 lowercase hex characters")
+		assert.False(t, seen[id], "Trace IDs should not repeat")
+		seen[id] = true
+	}
+}
+
+func TestNewSpanID(t *testing.T) {
+	t.Parallel()
+
+	for range 1000 {
+		assert.Regexp(t, spanIDPattern, NewSpanID(), "Span ID should be 16 lowercase hex characters")
+	}
+}
+
+func TestEnsureTraceID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		setupCtx    func() context.Context
+		verify      func(*testing.T, context.Context)
+		description string
+	}{
+		{
+			name:     "sets trace ID when missing",
+			setupCtx: func() context.Context { return context.Background() },
+			verify: func(t *testing.T, ctx context.Context) {
+				assert.Regexp(t, traceIDPattern, GetTraceID(ctx))
+			},
+			description: "A new trace ID should be generated",
+		},
+		{
+			name: "keeps existing trace ID",
+			setupCtx: func() context.Context {
+				return SetTraceID(context.Background(), "trace-existing")
+			},
+			verify: func(t *testing.T, ctx context.Context) {
+				assert.Equal(t, "trace-existing", GetTraceID(ctx))
+			},
+			description: "An existing trace ID should not be replaced",
+		},
+		{
+			name: "keeps other values",
+			setupCtx: func() context.Context {
+				return SetDeviceID(context.Background(), "device-123")
+			},
+			verify: func(t *testing.T, ctx context.Context) {
+				assert.Equal(t, "device-123", GetDeviceID(ctx))
+				assert.NotEmpty(t, GetTraceID(ctx))
+			},
+			description: "Other values should survive",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.verify(t, EnsureTraceID(tc.setupCtx()))
+		})
+	}
+}
+
+func TestNewTraceIDConcurrent(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+		wg   sync.WaitGroup
+	)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 500 {
+				id := NewTraceID()
+				mu.Lock()
+				assert.False(t, seen[id], "Trace IDs should not repeat across goroutines")
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// not parallel: swaps the package random source
+func TestSetRandSource(t *testing.T) {
+	t.Cleanup(func() { SetRandSource(nil) })
+
+	// the all-zero ID is invalid, so zeros from the source must be skipped
+	SetRandSource(&sequenceSource{vals: []uint64{0, 0, 0x0102030405060708, 0x090a0b0c0d0e0f10}})
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", NewTraceID())
+
+	SetRandSource(&sequenceSource{vals: []uint64{0, 0xdeadbeef}})
+	assert.Equal(t, "00000000deadbeef", NewSpanID())
+
+	SetRandSource(nil)
+	assert.NotEqual(t, NewTraceID(), NewTraceID(), "Default source should be restored")
+}
@@ -0,0 +1,478 @@
+package ctxutil
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidID is returned when parsing a malformed ID.
+var ErrInvalidID = errors.New("ctxutil: invalid ID")
+
+// IDGenerator generates IDs for the Ensure* helpers.
+// Implementations must be safe for concurrent use.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc adapts an ordinary function to the IDGenerator interface.
+type IDGeneratorFunc func() string
+
+// NewID calls f().
+func (f IDGeneratorFunc) NewID() string { return f() }
+
+// generatorHolder lets an IDGenerator interface live in an atomic.Pointer.
+type generatorHolder struct {
+	gen IDGenerator
+}
+
+var idGenerator atomic.Pointer[generatorHolder]
+
+// SetIDGenerator installs the generator used by every Ensure* helper
+// for contexts without their own generator, see WithIDGenerator.
+// Passing nil restores the default TraceIDGenerator.
+func SetIDGenerator(gen IDGenerator) {
+	if gen == nil {
+		idGenerator.Store(nil)
+		return
+	}
+	idGenerator.Store(&generatorHolder{gen: gen})
+}
+
+// WithIDGenerator sets the generator used by the Ensure* helpers for this context,
+// taking precedence over the one installed with SetIDGenerator.
+func WithIDGenerator(ctx context.Context, gen IDGenerator) context.Context {
+	return update(ctx, func(v *contextValues) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		v.idGenerator = gen
+	})
+}
+
+// newID returns an ID from the context's generator,
+// falling back to the installed one.
+func newID(ctx context.Context) string {
+	vals := getValues(ctx)
+	vals.mu.Lock()
+	gen := vals.idGenerator
+	vals.mu.Unlock()
+
+	if gen != nil {
+		return gen.NewID()
+	}
+	if h := idGenerator.Load(); h != nil {
+		return h.gen.NewID()
+	}
+	return NewTraceID()
+}
+
+// TraceIDGenerator generates W3C trace IDs, see NewTraceID. It is the default.
+type TraceIDGenerator struct{}
+
+// NewID returns a new W3C trace ID.
+func (TraceIDGenerator) NewID() string { return NewTraceID() }
+
+// Valid reports whether id is a valid W3C trace ID.
+func (TraceIDGenerator) Valid(id string) bool {
+	if len(id) != 32 || strings.ToLower(id) != id {
+		return false
+	}
+	b, err := hex.DecodeString(id)
+	return err == nil && !isZero(b)
+}
+
+// SeededIDGenerator generates a reproducible sequence of IDs shaped like
+// W3C trace IDs, for golden-file tests. Each ID is derived from the seed
+// and a counter only, so it doesn't depend on time or randomness and works
+// the same inside testing/synctest bubbles.
+// IDs are only reproducible if they are requested in a deterministic order.
+type SeededIDGenerator struct {
+	seed    uint64
+	counter atomic.Uint64
+}
+
+// NewSeededIDGenerator creates a deterministic generator for the given seed.
+func NewSeededIDGenerator(seed uint64) *SeededIDGenerator {
+	return &SeededIDGenerator{seed: seed}
+}
+
+// NewID returns the next ID in the sequence.
+func (g *SeededIDGenerator) NewID() string {
+	// the seed is mixed before stepping through the stream, so that
+	// seeds close to each other don't yield shifted copies of one stream
+	base := splitmix64(g.seed)
+
+	var b [16]byte
+	for isZero(b[:]) {
+		n := g.counter.Add(1)
+		binary.BigEndian.PutUint64(b[:8], splitmix64(base+2*n*splitmixGamma))
+		binary.BigEndian.PutUint64(b[8:], splitmix64(base+(2*n+1)*splitmixGamma))
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Reset restarts the sequence from the beginning.
+func (g *SeededIDGenerator) Reset() {
+	g.counter.Store(0)
+}
+
+// splitmixGamma is the SplitMix64 state increment.
+const splitmixGamma = 0x9e3779b97f4a7c15
+
+// splitmix64 returns the SplitMix64 output for the given state.
+func splitmix64(x uint64) uint64 {
+	x += splitmixGamma
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// UUID is an RFC 9562 UUID.
+type UUID [16]byte
+
+// ParseUUID parses a UUID in its canonical 8-4-4-4-12 hex form.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("%w: %q is not a UUID", ErrInvalidID, s)
+	}
+	digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return u, fmt.Errorf("%w: %q is not a UUID", ErrInvalidID, s)
+	}
+	if u[8]&0xc0 != 0x80 {
+		return u, fmt.Errorf("%w: %q is not an RFC 9562 UUID", ErrInvalidID, s)
+	}
+	return u, nil
+}
+
+// String returns the canonical lowercase 8-4-4-4-12 form of the UUID.
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// Version returns the UUID version.
+func (u UUID) Version() int { return int(u[6] >> 4) }
+
+// Time returns the creation time of a version 7 UUID, or the zero time otherwise.
+func (u UUID) Time() time.Time {
+	if u.Version() != 7 {
+		return time.Time{}
+	}
+	var b [8]byte
+	copy(b[2:], u[:6])
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(b[:])))
+}
+
+// setVersion stamps the version and RFC 9562 variant bits.
+func (u *UUID) setVersion(v byte) {
+	u[6] = u[6]&0x0f | v<<4
+	u[8] = u[8]&0x3f | 0x80
+}
+
+// UUIDv4Generator generates random version 4 UUIDs.
+type UUIDv4Generator struct{}
+
+// NewID returns a new version 4 UUID.
+func (UUIDv4Generator) NewID() string {
+	var u UUID
+	fillRandom(u[:])
+	u.setVersion(4)
+	return u.String()
+}
+
+// Valid reports whether id is a version 4 UUID.
+func (UUIDv4Generator) Valid(id string) bool {
+	u, err := ParseUUID(id)
+	return err == nil && u.Version() == 4
+}
+
+// UUIDv7Generator generates time-ordered version 7 UUIDs.
+// The 12 bits following the millisecond timestamp hold the sub-millisecond
+// fraction, so IDs from the same process sort by creation time.
+type UUIDv7Generator struct{}
+
+// NewID returns a new version 7 UUID.
+func (UUIDv7Generator) NewID() string {
+	now := time.Now()
+	ms := uint64(now.UnixMilli())
+	frac := uint64(now.Nanosecond()%int(time.Millisecond)) * 4096 / uint64(time.Millisecond)
+
+	var u UUID
+	fillRandom(u[8:])
+	binary.BigEndian.PutUint64(u[0:8], ms<<16|frac)
+	u.setVersion(7)
+	return u.String()
+}
+
+// Valid reports whether id is a version 7 UUID.
+func (UUIDv7Generator) Valid(id string) bool {
+	u, err := ParseUUID(id)
+	return err == nil && u.Version() == 7
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID is a Universally Unique Lexicographically Sortable Identifier:
+// a 48-bit millisecond timestamp followed by 80 random bits.
+type ULID [16]byte
+
+// ParseULID parses a 26 character Crockford base32 ULID, ignoring case.
+func ParseULID(s string) (ULID, error) {
+	var u ULID
+	if len(s) != 26 || s[0] > '7' {
+		return u, fmt.Errorf("%w: %q is not a ULID", ErrInvalidID, s)
+	}
+	// the 130 encoded bits carry 128 bits of data, the top 2 are always zero
+	for i := range 26 {
+		v := strings.IndexByte(crockford, upper(s[i]))
+		if v < 0 {
+			return u, fmt.Errorf("%w: %q is not a ULID", ErrInvalidID, s)
+		}
+		for j := range 5 {
+			bit := i*5 - 2 + j
+			if bit >= 0 && v>>(4-j)&1 == 1 {
+				u[bit/8] |= 1 << (7 - bit%8)
+			}
+		}
+	}
+	return u, nil
+}
+
+// String returns the 26 character Crockford base32 form of the ULID.
+func (u ULID) String() string {
+	var buf [26]byte
+	for i := range buf {
+		var v byte
+		for j := range 5 {
+			bit := i*5 - 2 + j
+			if bit >= 0 && u[bit/8]>>(7-bit%8)&1 == 1 {
+				v |= 1 << (4 - j)
+			}
+		}
+		buf[i] = crockford[v]
+	}
+	return string(buf[:])
+}
+
+// Time returns the creation time of the ULID.
+func (u ULID) Time() time.Time {
+	var b [8]byte
+	copy(b[2:], u[:6])
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(b[:])))
+}
+
+// ULIDGenerator generates ULIDs.
+type ULIDGenerator struct{}
+
+// NewID returns a new ULID.
+func (ULIDGenerator) NewID() string {
+	var u ULID
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixMilli()))
+	copy(u[:6], ts[2:])
+	fillRandom(u[6:])
+	return u.String()
+}
+
+// Valid reports whether id is a ULID.
+func (ULIDGenerator) Valid(id string) bool {
+	_, err := ParseULID(id)
+	return err == nil
+}
+
+// base62 is the alphabet used by KSUIDs.
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ksuidEpoch is the KSUID epoch, 2014-05-13T16:53:20Z, in Unix seconds.
+const ksuidEpoch = 1400000000
+
+// KSUID is a K-Sortable Unique IDentifier:
+// a 32-bit second timestamp followed by 128 random bits.
+type KSUID [20]byte
+
+// ParseKSUID parses a 27 character base62 KSUID.
+func ParseKSUID(s string) (KSUID, error) {
+	var k KSUID
+	if len(s) != 27 {
+		return k, fmt.Errorf("%w: %q is not a KSUID", ErrInvalidID, s)
+	}
+	for i := range len(s) {
+		carry := strings.IndexByte(base62, s[i])
+		if carry < 0 {
+			return k, fmt.Errorf("%w: %q is not a KSUID", ErrInvalidID, s)
+		}
+		for j := len(k) - 1; j >= 0; j-- {
+			acc := int(k[j])*62 + carry
+			k[j] = byte(acc)
+			carry = acc >> 8
+		}
+		if carry != 0 {
+			return k, fmt.Errorf("%w: %q overflows a KSUID", ErrInvalidID, s)
+		}
+	}
+	return k, nil
+}
+
+// String returns the 27 character base62 form of the KSUID.
+func (k KSUID) String() string {
+	var buf [27]byte
+	num := k
+	for i := len(buf) - 1; i >= 0; i-- {
+		var rem int
+		for j := range num {
+			acc := rem<<8 | int(num[j])
+			num[j] = byte(acc / 62)
+			rem = acc % 62
+		}
+		buf[i] = base62[rem]
+	}
+	return string(buf[:])
+}
+
+// Time returns the creation time of the KSUID.
+func (k KSUID) Time() time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint32(k[:4]))+ksuidEpoch, 0)
+}
+
+// KSUIDGenerator generates KSUIDs.
+type KSUIDGenerator struct{}
+
+// NewID returns a new KSUID.
+func (KSUIDGenerator) NewID() string {
+	var k KSUID
+	binary.BigEndian.PutUint32(k[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	fillRandom(k[4:])
+	return k.String()
+}
+
+// Valid reports whether id is a KSUID.
+func (KSUIDGenerator) Valid(id string) bool {
+	_, err := ParseKSUID(id)
+	return err == nil
+}
+
+// SnowflakeEpoch is the epoch of Snowflake timestamps, 2020-01-01T00:00:00Z.
+var SnowflakeEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+
+	// MaxSnowflakeNode is the largest node ID a SnowflakeGenerator accepts.
+	MaxSnowflakeNode = 1<<snowflakeNodeBits - 1
+)
+
+// SnowflakeID is a 63-bit Snowflake ID:
+// 41 bits of milliseconds since SnowflakeEpoch, a 10-bit node ID
+// and a 12-bit per-millisecond sequence number.
+type SnowflakeID int64
+
+// ParseSnowflake parses the decimal form of a Snowflake ID.
+func ParseSnowflake(s string) (SnowflakeID, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%w: %q is not a Snowflake ID", ErrInvalidID, s)
+	}
+	return SnowflakeID(n), nil
+}
+
+// String returns the decimal form of the Snowflake ID.
+func (id SnowflakeID) String() string { return strconv.FormatInt(int64(id), 10) }
+
+// Time returns the creation time of the Snowflake ID.
+func (id SnowflakeID) Time() time.Time {
+	return SnowflakeEpoch.Add(time.Duration(id>>(snowflakeNodeBits+snowflakeSeqBits)) * time.Millisecond)
+}
+
+// Node returns the node ID of the generator that created the Snowflake ID.
+func (id SnowflakeID) Node() int64 {
+	return int64(id>>snowflakeSeqBits) & MaxSnowflakeNode
+}
+
+// Sequence returns the per-millisecond sequence number of the Snowflake ID.
+func (id SnowflakeID) Sequence() int64 {
+	return int64(id) & (1<<snowflakeSeqBits - 1)
+}
+
+// SnowflakeGenerator generates Snowflake IDs for a single node.
+// Every process generating IDs concurrently must use a distinct node ID.
+type SnowflakeGenerator struct {
+	node int64
+
+	mu     sync.Mutex
+	lastMs int64
+	seq    int64
+}
+
+// NewSnowflakeGenerator creates a Snowflake generator for the given node ID,
+// which must be between 0 and MaxSnowflakeNode.
+func NewSnowflakeGenerator(node int64) (*SnowflakeGenerator, error) {
+	if node < 0 || node > MaxSnowflakeNode {
+		return nil, fmt.Errorf("ctxutil: snowflake node ID %d out of range [0, %d]", node, MaxSnowflakeNode)
+	}
+	return &SnowflakeGenerator{node: node}, nil
+}
+
+// NewID returns a new Snowflake ID.
+// If the sequence for the current millisecond is exhausted,
+// it waits for the next millisecond.
+func (g *SnowflakeGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := time.Since(SnowflakeEpoch).Milliseconds()
+	if ms < g.lastMs {
+		// never hand out a timestamp older than one already used
+		ms = g.lastMs
+	}
+
+	if ms == g.lastMs {
+		g.seq = (g.seq + 1) & (1<<snowflakeSeqBits - 1)
+		if g.seq == 0 {
+			for ms <= g.lastMs {
+				time.Sleep(time.Millisecond / 10)
+				ms = time.Since(SnowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastMs = ms
+
+	id := ms<<(snowflakeNodeBits+snowflakeSeqBits) | g.node<<snowflakeSeqBits | g.seq
+	return SnowflakeID(id).String()
+}
+
+// Valid reports whether id is a Snowflake ID.
+func (g *SnowflakeGenerator) Valid(id string) bool {
+	_, err := ParseSnowflake(id)
+	return err == nil
+}
+
+// upper converts an ASCII letter to upper case.
+func upper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
@@ -0,0 +1,294 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validator is implemented by every generator shipped with the package.
+type validator interface {
+	IDGenerator
+	Valid(id string) bool
+}
+
+func TestIDGenerators(t *testing.T) {
+	t.Parallel()
+
+	snowflake, err := NewSnowflakeGenerator(42)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		gen         validator
+		invalid     []string
+		description string
+	}{
+		{
+			name:        "trace ID",
+			gen:         TraceIDGenerator{},
+			invalid:     []string{"", "00000000000000000000000000000000", "4BF92F3577B34DA6A3CE929D0E0E4736", "xyz"},
+			description: "W3C trace IDs",
+		},
+		{
+			name:        "UUIDv4",
+			gen:         UUIDv4Generator{},
+			invalid:     []string{"", "not-a-uuid", "01890a5d-ac96-774b-bcce-b302099a8057", "f47ac10b-58cc-4372-0567-0e02b2c3d479"},
+			description: "Random UUIDs",
+		},
+		{
+			name:        "UUIDv7",
+			gen:         UUIDv7Generator{},
+			invalid:     []string{"", "f47ac10b-58cc-4372-a567-0e02b2c3d479"},
+			description: "Time-ordered UUIDs",
+		},
+		{
+			name:        "ULID",
+			gen:         ULIDGenerator{},
+			invalid:     []string{"", "81ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FA!", "01ARZ3NDEK"},
+			description: "ULIDs",
+		},
+		{
+			name:        "KSUID",
+			gen:         KSUIDGenerator{},
+			invalid:     []string{"", "zzzzzzzzzzzzzzzzzzzzzzzzzzz", "0ujtsYcgvSTl8PAuAdqWYSMnLO-"},
+			description: "KSUIDs",
+		},
+		{
+			name:        "Snowflake",
+			gen:         snowflake,
+			invalid:     []string{"", "-1", "0", "abc"},
+			description: "Snowflake IDs",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			seen := make(map[string]bool)
+			for range 1000 {
+				id := tc.gen.NewID()
+				assert.True(t, tc.gen.Valid(id), "%s: generated ID %q should be valid", tc.description, id)
+				assert.False(t, seen[id], "%s: IDs should not repeat", tc.description)
+				seen[id] = true
+			}
+
+			for _, id := range tc.invalid {
+				assert.False(t, tc.gen.Valid(id), "%s: %q should be invalid", tc.description, id)
+			}
+		})
+	}
+}
+
+func TestUUID(t *testing.T) {
+	t.Parallel()
+
+	// test vector from RFC 9562, appendix A.6
+	u, err := ParseUUID("017F22E2-79B0-7CC3-98C4-DC0C0C07398F")
+	require.NoError(t, err)
+	assert.Equal(t, 7, u.Version())
+	assert.Equal(t, "017f22e2-79b0-7cc3-98c4-dc0c0c07398f", u.String(), "String should be canonical lowercase")
+	assert.Equal(t, int64(1645557742000), u.Time().UnixMilli())
+
+	u, err = ParseUUID(UUIDv4Generator{}.NewID())
+	require.NoError(t, err)
+	assert.Equal(t, 4, u.Version())
+	assert.True(t, u.Time().IsZero(), "Only version 7 UUIDs carry a time")
+
+	before := time.Now().Truncate(time.Millisecond)
+	u, err = ParseUUID(UUIDv7Generator{}.NewID())
+	require.NoError(t, err)
+	assert.WithinRange(t, u.Time(), before, time.Now())
+
+	// IDs generated in a later millisecond sort after earlier ones
+	first := UUIDv7Generator{}.NewID()
+	time.Sleep(2 * time.Millisecond)
+	assert.Less(t, first, UUIDv7Generator{}.NewID(), "Version 7 UUIDs should sort by creation time")
+
+	_, err = ParseUUID("01890a5d_ac96_774b_bcce_b302099a8057")
+	assert.ErrorIs(t, err, ErrInvalidID)
+}
+
+func TestULID(t *testing.T) {
+	t.Parallel()
+
+	u, err := ParseULID("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1469922850259), u.Time().UnixMilli())
+	assert.Equal(t, "01ARZ3NDEKTSV4RRFFQ69G5FAV", u.String())
+
+	lower, err := ParseULID("01arz3ndektsv4rrffq69g5fav")
+	require.NoError(t, err)
+	assert.Equal(t, u, lower, "Parsing should ignore case")
+
+	maxID, err := ParseULID("7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+	require.NoError(t, err)
+	assert.Equal(t, ULID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, maxID)
+
+	first := ULIDGenerator{}.NewID()
+	time.Sleep(2 * time.Millisecond)
+	assert.Less(t, first, ULIDGenerator{}.NewID(), "ULIDs should sort by creation time")
+
+	_, err = ParseULID("80000000000000000000000000")
+	assert.ErrorIs(t, err, ErrInvalidID, "ULIDs larger than 128 bits should be rejected")
+}
+
+func TestKSUID(t *testing.T) {
+	t.Parallel()
+
+	k, err := ParseKSUID("0ujtsYcgvSTl8PAuAdqWYSMnLOv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1507608047), k.Time().Unix())
+	assert.Equal(t, "0ujtsYcgvSTl8PAuAdqWYSMnLOv", k.String())
+
+	maxID, err := ParseKSUID("aWgEPTl1tmebfsQzFP4bxwgy80V")
+	require.NoError(t, err)
+	assert.Equal(t, "aWgEPTl1tmebfsQzFP4bxwgy80V", maxID.String())
+
+	_, err = ParseKSUID("aWgEPTl1tmebfsQzFP4bxwgy80W")
+	assert.ErrorIs(t, err, ErrInvalidID, "KSUIDs larger than 160 bits should be rejected")
+
+	before := time.Now().Truncate(time.Second)
+	k, err = ParseKSUID(KSUIDGenerator{}.NewID())
+	require.NoError(t, err)
+	assert.WithinRange(t, k.Time(), before, time.Now())
+}
+
+func TestSnowflake(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewSnowflakeGenerator(-1)
+	assert.Error(t, err, "Negative node IDs should be rejected")
+	_, err = NewSnowflakeGenerator(MaxSnowflakeNode + 1)
+	assert.Error(t, err, "Node IDs above the maximum should be rejected")
+
+	gen, err := NewSnowflakeGenerator(MaxSnowflakeNode)
+	require.NoError(t, err)
+
+	before := time.Now().Truncate(time.Millisecond)
+	var prev SnowflakeID
+	for range 10000 {
+		id, err := ParseSnowflake(gen.NewID())
+		require.NoError(t, err)
+		assert.Equal(t, int64(MaxSnowflakeNode), id.Node())
+		assert.Greater(t, id, prev, "Snowflake IDs should be strictly increasing")
+		prev = id
+	}
+	assert.WithinRange(t, prev.Time(), before, time.Now())
+}
+
+// not parallel: swaps the package ID generator
+func TestSetIDGenerator(t *testing.T) {
+	t.Cleanup(func() { SetIDGenerator(nil) })
+
+	SetIDGenerator(IDGeneratorFunc(func() string { return "fixed-id" }))
+
+	ctx := EnsureTraceID(context.Background())
+	ctx = EnsureRequestID(ctx)
+	assert.Equal(t, "fixed-id", GetTraceID(ctx), "EnsureTraceID should use the installed generator")
+	assert.Equal(t, "fixed-id", GetRequestID(ctx), "EnsureRequestID should use the installed generator")
+
+	SetIDGenerator(UUIDv7Generator{})
+	ctx = EnsureRequestID(context.Background())
+	assert.True(t, UUIDv7Generator{}.Valid(GetRequestID(ctx)))
+
+	SetIDGenerator(nil)
+	ctx = EnsureRequestID(context.Background())
+	assert.True(t, TraceIDGenerator{}.Valid(GetRequestID(ctx)), "Default generator should be restored")
+}
+
+func TestSeededIDGenerator(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T)
+		description string
+	}{
+		{
+			name: "same seed yields same sequence",
+			verify: func(t *testing.T) {
+				a, b := NewSeededIDGenerator(42), NewSeededIDGenerator(42)
+				for range 100 {
+					id := a.NewID()
+					assert.Equal(t, id, b.NewID())
+					assert.True(t, TraceIDGenerator{}.Valid(id), "Seeded IDs should be valid trace IDs")
+				}
+			},
+			description: "Generators with the same seed must agree",
+		},
+		{
+			name: "different seeds diverge",
+			verify: func(t *testing.T) {
+				// seeds with small and even gaps used to yield shifted copies of one stream
+				seen := make(map[string]uint64)
+				for seed := range uint64(16) {
+					gen := NewSeededIDGenerator(seed)
+					for range 50 {
+						id := gen.NewID()
+						other, dup := seen[id]
+						assert.False(t, dup, "Seed %d repeats an ID of seed %d", seed, other)
+						seen[id] = seed
+					}
+				}
+			},
+			description: "Generators with different seeds must not agree",
+		},
+		{
+			name: "reset restarts the sequence",
+			verify: func(t *testing.T) {
+				gen := NewSeededIDGenerator(7)
+				first, second := gen.NewID(), gen.NewID()
+				assert.NotEqual(t, first, second)
+
+				gen.Reset()
+				assert.Equal(t, first, gen.NewID())
+				assert.Equal(t, second, gen.NewID())
+			},
+			description: "Reset should replay the sequence",
+		},
+		{
+			name: "context generator is used by Ensure helpers",
+			verify: func(t *testing.T) {
+				want := NewSeededIDGenerator(99)
+
+				ctx := WithIDGenerator(context.Background(), NewSeededIDGenerator(99))
+				ctx = EnsureTraceID(ctx)
+				ctx = EnsureRequestID(ctx)
+
+				assert.Equal(t, want.NewID(), GetTraceID(ctx))
+				assert.Equal(t, want.NewID(), GetRequestID(ctx))
+			},
+			description: "Per-context generators take precedence",
+		},
+		{
+			name: "deterministic inside synctest bubble",
+			verify: func(t *testing.T) {
+				synctest.Run(func() {
+					want := NewSeededIDGenerator(5)
+					ctx := WithIDGenerator(context.Background(), NewSeededIDGenerator(5))
+
+					for range 3 {
+						time.Sleep(time.Hour)
+						assert.Equal(t, want.NewID(), GetRequestID(EnsureRequestID(ctx)))
+						ctx = SetRequestID(ctx, "")
+					}
+				})
+			},
+			description: "Fake time in a bubble must not affect generated IDs",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.verify(t)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdleTimeout is the cancellation cause of a context created by
+// WithIdleTimeout that saw no activity for its idle timeout.
+var ErrIdleTimeout = errors.New("ctxutil: idle timeout")
+
+// WithIdleTimeout derives a context that is canceled once touch hasn't been
+// called for the idle duration, with ErrIdleTimeout as its cause unless
+// another one is set with WithCause.
+// Touching only records the time of the activity, so it's cheap enough to
+// call on every message; a single timer checks for inactivity when it fires
+// and re-arms itself for the time left.
+func WithIdleTimeout(ctx context.Context, idle time.Duration, opts ...Option) (context.Context, func(), context.CancelFunc) {
+	cause := newOptions(opts).cause
+	if cause == nil {
+		cause = ErrIdleTimeout
+	}
+
+	idleCtx, cancel := context.WithCancelCause(ctx)
+	clock := clockFrom(ctx)
+	start := clock.Now()
+
+	// time of the last activity, as an offset from start
+	var last atomic.Int64
+
+	var (
+		mu    sync.Mutex
+		timer Timer
+	)
+	mu.Lock()
+	timer = clock.AfterFunc(idle, func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if idleCtx.Err() != nil {
+			return
+		}
+		if left := idle - (clock.Now().Sub(start) - time.Duration(last.Load())); left > 0 {
+			timer.Reset(left)
+			return
+		}
+		cancel(cause)
+	})
+	mu.Unlock()
+
+	stop := context.AfterFunc(idleCtx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		timer.Stop()
+	})
+
+	touch := func() { last.Store(int64(clock.Now().Sub(start))) }
+
+	return idleCtx, touch, track("WithIdleTimeout", func() {
+		stop()
+		cancel(context.Canceled)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		timer.Stop()
+	})
+}
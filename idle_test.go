@@ -0,0 +1,114 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	errStale := errors.New("stale connection")
+
+	testCases := []struct {
+		name          string
+		opts          []Option
+		act           func(touch func(), cancelParent, cancel context.CancelFunc)
+		expectedErr   error
+		expectedCause error
+		description   string
+	}{
+		{
+			name:          "cancels after inactivity",
+			act:           func(func(), context.CancelFunc, context.CancelFunc) { time.Sleep(30 * time.Second) },
+			expectedErr:   context.Canceled,
+			expectedCause: ErrIdleTimeout,
+			description:   "No activity for the idle duration should cancel the context",
+		},
+		{
+			name: "activity keeps context alive",
+			act: func(touch func(), _, _ context.CancelFunc) {
+				for range 10 {
+					time.Sleep(20 * time.Second)
+					touch()
+				}
+				time.Sleep(29 * time.Second)
+			},
+			description: "Touching should postpone the idle timeout",
+		},
+		{
+			name: "idle after activity",
+			act: func(touch func(), _, _ context.CancelFunc) {
+				time.Sleep(20 * time.Second)
+				touch()
+				time.Sleep(30 * time.Second)
+			},
+			expectedErr:   context.Canceled,
+			expectedCause: ErrIdleTimeout,
+			description:   "Idle time should be measured from the last activity",
+		},
+		{
+			name: "heavy touching",
+			act: func(touch func(), _, _ context.CancelFunc) {
+				for range 100000 {
+					touch()
+					time.Sleep(time.Millisecond)
+				}
+			},
+			description: "Frequent touches should keep the context alive",
+		},
+		{
+			name:          "custom cause",
+			opts:          []Option{WithCause(errStale)},
+			act:           func(func(), context.CancelFunc, context.CancelFunc) { time.Sleep(30 * time.Second) },
+			expectedErr:   context.Canceled,
+			expectedCause: errStale,
+			description:   "WithCause should replace ErrIdleTimeout",
+		},
+		{
+			name:          "parent cancellation propagates",
+			act:           func(_ func(), cancelParent, _ context.CancelFunc) { cancelParent() },
+			expectedErr:   context.Canceled,
+			expectedCause: context.Canceled,
+			description:   "The idle context should end with its parent",
+		},
+		{
+			name:          "cancel ends the context",
+			act:           func(_ func(), _, cancel context.CancelFunc) { cancel() },
+			expectedErr:   context.Canceled,
+			expectedCause: context.Canceled,
+			description:   "Cancel should end the context right away",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				parentCtx, cancelParent := context.WithCancel(context.Background())
+				defer cancelParent()
+				parentCtx = SetTraceID(parentCtx, "trace-idle")
+
+				ctx, touch, cancel := WithIdleTimeout(parentCtx, 30*time.Second, tc.opts...)
+				defer cancel()
+				assert.Equal(t, "trace-idle", GetTraceID(ctx), "Trace ID should be preserved")
+
+				tc.act(touch, cancelParent, cancel)
+				synctest.Wait()
+
+				if tc.expectedErr == nil {
+					assert.NoError(t, ctx.Err(), tc.description)
+					return
+				}
+				assert.ErrorIs(t, ctx.Err(), tc.expectedErr, tc.description)
+				assert.ErrorIs(t, context.Cause(ctx), tc.expectedCause, tc.description)
+			})
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package ctxutil
 
-import "context"
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
 
 // setString sets a string value for a field in the context.
 func setString(ctx context.Context, setter func(*contextValues, string), value string) context.Context {
@@ -34,3 +39,315 @@ func getValues(ctx context.Context) *contextValues {
 func withValues(ctx context.Context, vals *contextValues) context.Context {
 	return context.WithValue(ctx, contextKey{}, vals)
 }
+
+// update applies fn to the values stored in the context,
+// attaching a fresh values store if there isn't one yet.
+func update(ctx context.Context, fn func(*contextValues)) context.Context {
+	vals := getValues(ctx)
+	fn(vals)
+	return withValues(ctx, vals)
+}
+
+// detach creates a fresh context without deadline or cancellation
+// that carries over the known values from the original context.
+// The recorded deadline sources are carried over too, see ExplainDeadline.
+func detach(ctx context.Context) context.Context {
+	detached := context.Background()
+	if n := deadlineChain(ctx); n != nil {
+		detached = context.WithValue(detached, deadlineKey{}, n)
+	}
+	vals := getValues(ctx)
+	if vals != nil {
+		return withValues(detached, vals)
+	}
+	return detached
+}
+
+// withDeadline derives a context from parent that ends at the deadline,
+// reporting the configured cause, or a *TimeoutError for the operation.
+// Deadlines are tracked with the parent's clock, see WithClock.
+func withDeadline(parent context.Context, deadline time.Time, operation string, o options) (context.Context, context.CancelFunc) {
+	clock := clockFrom(parent)
+	cause := o.timeoutCause(parent, operation, max(deadline.Sub(clock.Now()), 0))
+	if isRealClock(clock) {
+		parent = recordDeadline(parent, o.label, operation, func() time.Time { return deadline })
+		ctx, cancel := context.WithDeadlineCause(parent, deadline, cause)
+		return ctx, track(operation, cancel)
+	}
+
+	c := newRecordedTimerCtx(parent, o.label, operation, cause, clock)
+	c.setDeadline(deadline)
+	return c, track(operation, func() { c.cancel(context.Canceled) })
+}
+
+// errCtxKey is the key under which an errCtx returns itself.
+type errCtxKey struct{}
+
+// errCtx is a cancelable context that can end with any error. Unlike
+// with the contexts of the context package, which always end their
+// children with context.Canceled, contexts derived from it see that error.
+type errCtx struct {
+	parent   context.Context
+	causeCtx context.Context // holds the cause, which context.Cause looks up
+	setCause context.CancelCauseFunc
+	done     chan struct{}
+
+	mu         sync.Mutex
+	err        error
+	funcs      []afterFunc
+	nextID     int
+	stopParent func() bool
+}
+
+// afterFunc is a function registered with errCtx.AfterFunc.
+type afterFunc struct {
+	id int
+	f  func()
+}
+
+// newErrCtx creates an errCtx that ends with parent, with its error and cause.
+func newErrCtx(parent context.Context) *errCtx {
+	causeCtx, setCause := context.WithCancelCause(context.WithoutCancel(parent))
+	c := &errCtx{
+		parent:   parent,
+		causeCtx: causeCtx,
+		setCause: setCause,
+		done:     make(chan struct{}),
+	}
+	if err := parent.Err(); err != nil {
+		c.finish(err, context.Cause(parent))
+		return c
+	}
+	if parent.Done() != nil {
+		stop := afterDone(parent, func() { c.finish(parent.Err(), context.Cause(parent)) })
+
+		c.mu.Lock()
+		c.stopParent = stop
+		ended := c.err != nil
+		c.mu.Unlock()
+		if ended {
+			stop()
+		}
+	}
+	return c
+}
+
+// afterDone arranges for f to run once ctx is done. If ctx ends with an
+// errCtx, f runs as soon as it's done, before its Err is seen by anyone
+// waiting on Done; otherwise f runs on its own goroutine.
+func afterDone(ctx context.Context, f func()) (stop func() bool) {
+	if p, ok := ctx.Value(errCtxKey{}).(*errCtx); ok && p.done == ctx.Done() {
+		return p.AfterFunc(f)
+	}
+	return context.AfterFunc(ctx, f)
+}
+
+// Deadline returns the parent's deadline.
+func (c *errCtx) Deadline() (time.Time, bool) {
+	return c.parent.Deadline()
+}
+
+// Done returns a channel that's closed when the context ends.
+func (c *errCtx) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error the context ended with.
+func (c *errCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// Value returns the context itself for errCtxKey, and looks up any other
+// key, including the cancellation state, in the parent.
+func (c *errCtx) Value(key any) any {
+	if key == (errCtxKey{}) {
+		return c
+	}
+	return c.causeCtx.Value(key)
+}
+
+// AfterFunc arranges for f to run once the context ends. The context
+// package uses it to propagate the error to derived contexts.
+func (c *errCtx) AfterFunc(f func()) (stop func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		// the caller may hold a lock f needs
+		go f()
+		return func() bool { return false }
+	}
+
+	id := c.nextID
+	c.nextID++
+	c.funcs = append(c.funcs, afterFunc{id: id, f: f})
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for i, fn := range c.funcs {
+			if fn.id == id {
+				c.funcs = slices.Delete(c.funcs, i, i+1)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// finish ends the context with err and cause, unless it already ended,
+// and reports whether it did. A nil cause defaults to err.
+func (c *errCtx) finish(err, cause error) bool {
+	if cause == nil {
+		cause = err
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return false
+	}
+	c.setCause(cause)
+	c.err = err
+	close(c.done)
+	funcs := c.funcs
+	c.funcs = nil
+	stopParent := c.stopParent
+	c.mu.Unlock()
+
+	if stopParent != nil {
+		stopParent()
+	}
+	for _, fn := range funcs {
+		fn.f()
+	}
+	return true
+}
+
+// timerCtx is a cancelable context whose deadline can be set,
+// moved or cleared after creation. Once the deadline passes,
+// it and the contexts derived from it report context.DeadlineExceeded,
+// and Cause reports the given cause.
+type timerCtx struct {
+	*errCtx
+	cause error
+	clock Clock
+
+	mu       sync.Mutex
+	deadline time.Time // zero when there is none
+	timer    Timer
+	expired  bool
+	stopped  bool
+}
+
+// newTimerCtx creates a timerCtx without deadline.
+func newTimerCtx(parent context.Context, cause error, clock Clock) *timerCtx {
+	return &timerCtx{errCtx: newErrCtx(parent), cause: cause, clock: clock}
+}
+
+// newRecordedTimerCtx creates a timerCtx without deadline,
+// recording its deadline as set by operation, see ExplainDeadline.
+func newRecordedTimerCtx(parent context.Context, label, operation string, cause error, clock Clock) *timerCtx {
+	var c *timerCtx
+	parent = recordDeadline(parent, label, operation, func() time.Time { return c.ownDeadline() })
+	c = newTimerCtx(parent, cause, clock)
+	return c
+}
+
+// ownDeadline returns the deadline set on the context, ignoring the parent's.
+func (c *timerCtx) ownDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.deadline
+}
+
+// Deadline returns the current deadline, or the parent's if it's earlier.
+func (c *timerCtx) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	parent, ok := c.errCtx.Deadline()
+	if c.deadline.IsZero() || ok && parent.Before(c.deadline) {
+		return parent, ok
+	}
+	return c.deadline, true
+}
+
+// setDeadline moves the deadline, reusing the same timer.
+// A deadline in the past expires the context right away.
+func (c *timerCtx) setDeadline(deadline time.Time) {
+	c.mu.Lock()
+	if c.stopped || c.expired || c.errCtx.Err() != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.deadline = deadline
+
+	left := deadline.Sub(c.clock.Now())
+	if left <= 0 {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		c.expired = true
+		c.mu.Unlock()
+
+		c.finish(context.DeadlineExceeded, c.cause)
+		return
+	}
+
+	if c.timer == nil {
+		c.timer = c.clock.AfterFunc(left, c.fire)
+	} else {
+		c.timer.Reset(left)
+	}
+	c.mu.Unlock()
+}
+
+// clearDeadline removes the deadline and stops the timer.
+func (c *timerCtx) clearDeadline() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped || c.expired || c.errCtx.Err() != nil {
+		return
+	}
+	c.deadline = time.Time{}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+// fire runs when the timer goes off. The deadline may have been moved
+// concurrently, in which case the timer is armed again.
+func (c *timerCtx) fire() {
+	c.mu.Lock()
+	if c.stopped || c.expired || c.deadline.IsZero() || c.errCtx.Err() != nil {
+		c.mu.Unlock()
+		return
+	}
+	if left := c.deadline.Sub(c.clock.Now()); left > 0 {
+		c.timer.Reset(left)
+		c.mu.Unlock()
+		return
+	}
+	c.expired = true
+	c.mu.Unlock()
+
+	c.finish(context.DeadlineExceeded, c.cause)
+}
+
+// cancel stops the timer and cancels the context with the given cause.
+func (c *timerCtx) cancel(cause error) {
+	c.mu.Lock()
+	c.stopped = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+
+	c.finish(context.Canceled, cause)
+}
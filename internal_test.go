@@ -2,7 +2,9 @@ package ctxutil
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"testing/synctest"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -496,3 +498,103 @@ func TestGettersAndSettersTogether(t *testing.T) {
 	assert.Equal(t, "device-updated", getString(ctx, deviceGetter), "DeviceID should be unchanged")
 	assert.Empty(t, getString(ctx, traceGetter), "TraceID should be cleared")
 }
+
+func TestTimerCtx(t *testing.T) {
+	t.Parallel()
+
+	errExpired := errors.New("expired")
+
+	testCases := []struct {
+		name          string
+		operation     func(*timerCtx)
+		expectedErr   error
+		expectedCause error
+		description   string
+	}{
+		{
+			name:        "no deadline never expires",
+			operation:   func(*timerCtx) { time.Sleep(time.Hour) },
+			expectedErr: nil,
+			description: "Without a deadline the context should stay alive",
+		},
+		{
+			name: "expires at deadline",
+			operation: func(c *timerCtx) {
+				c.setDeadline(time.Now().Add(time.Second))
+				time.Sleep(time.Second)
+			},
+			expectedErr:   context.DeadlineExceeded,
+			expectedCause: errExpired,
+			description:   "Reaching the deadline should report DeadlineExceeded",
+		},
+		{
+			name: "moved deadline is honored",
+			operation: func(c *timerCtx) {
+				c.setDeadline(time.Now().Add(time.Second))
+				time.Sleep(500 * time.Millisecond)
+				c.setDeadline(time.Now().Add(time.Second))
+				time.Sleep(900 * time.Millisecond)
+			},
+			expectedErr: nil,
+			description: "Moving the deadline later should postpone expiry",
+		},
+		{
+			name: "cleared deadline never expires",
+			operation: func(c *timerCtx) {
+				c.setDeadline(time.Now().Add(time.Second))
+				c.clearDeadline()
+				time.Sleep(time.Hour)
+			},
+			expectedErr: nil,
+			description: "Clearing the deadline should stop the timer",
+		},
+		{
+			name: "cancel wins over later deadline",
+			operation: func(c *timerCtx) {
+				c.setDeadline(time.Now().Add(time.Second))
+				c.cancel(context.Canceled)
+				time.Sleep(time.Hour)
+			},
+			expectedErr:   context.Canceled,
+			expectedCause: context.Canceled,
+			description:   "Canceling should not be reported as a timeout",
+		},
+		{
+			name: "cancel after expiry keeps timeout",
+			operation: func(c *timerCtx) {
+				c.setDeadline(time.Now().Add(time.Second))
+				time.Sleep(time.Hour)
+				c.cancel(context.Canceled)
+			},
+			expectedErr:   context.DeadlineExceeded,
+			expectedCause: errExpired,
+			description:   "The first reason the context ended should stick",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				c := newTimerCtx(context.Background(), errExpired, realClock{})
+				defer c.cancel(context.Canceled)
+				child, cancelChild := context.WithCancel(c)
+				defer cancelChild()
+
+				tc.operation(c)
+				synctest.Wait()
+
+				if tc.expectedErr == nil {
+					assert.NoError(t, c.Err(), tc.description)
+					assert.NoError(t, child.Err(), tc.description)
+					return
+				}
+				assert.ErrorIs(t, c.Err(), tc.expectedErr, tc.description)
+				assert.ErrorIs(t, context.Cause(c), tc.expectedCause, tc.description)
+				assert.ErrorIs(t, child.Err(), tc.expectedErr, "Derived contexts should see the same error")
+				assert.ErrorIs(t, context.Cause(child), tc.expectedCause, "Derived contexts should see the same cause")
+			})
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package ctxutil
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// JoinAll creates a context that is done only once every one of ctxs is
+// done, reporting the error and cause of the last one. Its deadline is the
+// latest of the inputs still running, if they all have one. It carries the
+// ctxutil values of the inputs, merged like Merge does.
+// JoinAll of no contexts returns a context that is already done.
+func JoinAll(ctxs ...context.Context) (context.Context, context.CancelFunc) {
+	r := NewRefcount(withValues(context.Background(), mergeValues(MergePolicy{}, ctxs)))
+	if len(ctxs) == 0 {
+		r.Cancel()
+	}
+	// attached together, so that an input that is already done
+	// can't end the context before the others are attached
+	r.ctx.attach(ctxs...)
+	return r.Context(), track("JoinAll", r.Cancel)
+}
+
+// Refcount is a shared context for work serving several callers, such as
+// coalesced requests. It stays alive while any attached context is running
+// and is canceled once the last one is done, with its error and cause.
+type Refcount struct {
+	ctx *refcountCtx
+}
+
+// NewRefcount creates a Refcount whose context is derived from ctx,
+// typically a server context: it ends with ctx too, and carries its values.
+// The context stays alive until the last attached context is done.
+func NewRefcount(ctx context.Context) *Refcount {
+	c := &refcountCtx{
+		errCtx:   newErrCtx(ctx),
+		attached: make(map[int]attachment),
+	}
+	c.AfterFunc(c.detachAll)
+	return &Refcount{ctx: c}
+}
+
+// Context returns the shared context.
+func (r *Refcount) Context() context.Context {
+	return r.ctx
+}
+
+// Attach keeps the shared context alive until ctx is done.
+// It reports false if the shared context is already done.
+func (r *Refcount) Attach(ctx context.Context) bool {
+	return r.ctx.attach(ctx)
+}
+
+// Cancel cancels the shared context regardless of the attached contexts.
+func (r *Refcount) Cancel() {
+	r.ctx.finish(context.Canceled, context.Canceled)
+}
+
+// attachment is a context keeping a refcountCtx alive.
+type attachment struct {
+	ctx  context.Context
+	stop func() bool
+}
+
+// refcountCtx is canceled once its last attached context is done,
+// with its error, which contexts derived from it see too.
+type refcountCtx struct {
+	*errCtx
+
+	mu       sync.Mutex
+	attached map[int]attachment
+	nextID   int
+	closing  bool // the last attached context is done
+}
+
+// attach keeps the context alive until every one of ctxs is done.
+func (c *refcountCtx) attach(ctxs ...context.Context) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closing || c.errCtx.Err() != nil {
+		return false
+	}
+
+	for _, ctx := range ctxs {
+		id := c.nextID
+		c.nextID++
+		c.attached[id] = attachment{
+			ctx: ctx,
+			stop: afterDone(ctx, func() {
+				c.mu.Lock()
+				if _, ok := c.attached[id]; !ok {
+					c.mu.Unlock()
+					return
+				}
+				delete(c.attached, id)
+				last := len(c.attached) == 0
+				c.closing = last
+				c.mu.Unlock()
+
+				if last {
+					c.finish(ctx.Err(), context.Cause(ctx))
+				}
+			}),
+		}
+	}
+	return true
+}
+
+// detachAll stops watching the attached contexts.
+func (c *refcountCtx) detachAll() {
+	c.mu.Lock()
+	attached := c.attached
+	c.attached = nil
+	c.mu.Unlock()
+
+	for _, a := range attached {
+		a.stop()
+	}
+}
+
+// Deadline returns the latest deadline of the attached contexts,
+// if they all have one, or the parent's if it's earlier.
+func (c *refcountCtx) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var latest time.Time
+	for _, a := range c.attached {
+		d, ok := a.ctx.Deadline()
+		if !ok {
+			latest = time.Time{}
+			break
+		}
+		if d.After(latest) {
+			latest = d
+		}
+	}
+
+	parent, ok := c.errCtx.Deadline()
+	if latest.IsZero() || ok && parent.Before(latest) {
+		return parent, ok
+	}
+	return latest, true
+}
@@ -0,0 +1,265 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinAll(t *testing.T) {
+	t.Parallel()
+
+	errLast := errors.New("last caller gone")
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T)
+		description string
+	}{
+		{
+			name: "done once every input is done",
+			verify: func(t *testing.T) {
+				firstCtx, cancelFirst := context.WithCancel(SetTraceID(context.Background(), "trace-first"))
+				secondCtx, cancelSecond := context.WithCancelCause(SetTraceID(context.Background(), "trace-second"))
+
+				ctx, cancel := JoinAll(firstCtx, secondCtx)
+				defer cancel()
+
+				assert.Equal(t, "trace-first", GetTraceID(ctx), "Values should be merged")
+
+				cancelFirst()
+				synctest.Wait()
+				assert.NoError(t, ctx.Err(), "One input is still running")
+
+				cancelSecond(errLast)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+				assert.ErrorIs(t, context.Cause(ctx), errLast, "Cause should come from the last input")
+			},
+			description: "JoinAll should wait for every input",
+		},
+		{
+			name: "deadline",
+			verify: func(t *testing.T) {
+				shortCtx, cancelShort := context.WithTimeout(context.Background(), time.Second)
+				defer cancelShort()
+				longCtx, cancelLong := context.WithTimeout(context.Background(), time.Minute)
+				defer cancelLong()
+
+				ctx, cancel := JoinAll(shortCtx, longCtx)
+				defer cancel()
+
+				deadline, ok := ctx.Deadline()
+				assert.True(t, ok)
+				assert.Equal(t, time.Minute, time.Until(deadline), "Latest deadline should win")
+
+				child, cancelChild := context.WithCancel(ctx)
+				defer cancelChild()
+
+				time.Sleep(time.Minute)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+				assert.ErrorIs(t, child.Err(), context.DeadlineExceeded, "Derived contexts should see the same error")
+			},
+			description: "JoinAll should report the latest deadline",
+		},
+		{
+			name: "already done input",
+			verify: func(t *testing.T) {
+				doneCtx, cancelDone := context.WithCancel(context.Background())
+				cancelDone()
+				liveCtx, cancelLive := context.WithCancelCause(context.Background())
+				defer cancelLive(nil)
+
+				ctx, cancel := JoinAll(doneCtx, liveCtx)
+				defer cancel()
+
+				synctest.Wait()
+				assert.NoError(t, ctx.Err(), "A done input should not end the join before the others attach")
+
+				cancelLive(errLast)
+				synctest.Wait()
+				assert.ErrorIs(t, context.Cause(ctx), errLast)
+			},
+			description: "JoinAll should wait for the inputs still running",
+		},
+		{
+			name: "every input already done",
+			verify: func(t *testing.T) {
+				doneCtx, cancelDone := context.WithCancel(context.Background())
+				cancelDone()
+
+				ctx, cancel := JoinAll(doneCtx, doneCtx)
+				defer cancel()
+
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+			},
+			description: "JoinAll of done contexts should end",
+		},
+		{
+			name: "no deadline if any input has none",
+			verify: func(t *testing.T) {
+				timedCtx, cancelTimed := context.WithTimeout(context.Background(), time.Second)
+				defer cancelTimed()
+
+				ctx, cancel := JoinAll(timedCtx, context.Background())
+				defer cancel()
+
+				_, ok := ctx.Deadline()
+				assert.False(t, ok)
+			},
+			description: "An input without deadline may run forever",
+		},
+		{
+			name: "no inputs",
+			verify: func(t *testing.T) {
+				ctx, cancel := JoinAll()
+				defer cancel()
+
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+			},
+			description: "JoinAll of nothing is done right away",
+		},
+		{
+			name: "cancel",
+			verify: func(t *testing.T) {
+				ctx, cancel := JoinAll(context.Background())
+				cancel()
+
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+			},
+			description: "Cancel should end the context regardless of the inputs",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				tc.verify(t)
+			})
+		})
+	}
+}
+
+// hookedCtx calls onErr the first time Err is called once it's done.
+type hookedCtx struct {
+	context.Context
+	once  sync.Once
+	onErr func()
+}
+
+func (c *hookedCtx) Err() error {
+	err := c.Context.Err()
+	if err != nil {
+		c.once.Do(c.onErr)
+	}
+	return err
+}
+
+func TestRefcount(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, context.Context, context.CancelFunc)
+		description string
+	}{
+		{
+			name: "alive until last caller is gone",
+			verify: func(t *testing.T, srvCtx context.Context, _ context.CancelFunc) {
+				r := NewRefcount(srvCtx)
+				shared := r.Context()
+				assert.Equal(t, "trace-server", GetTraceID(shared), "Values should come from the parent")
+
+				firstCtx, cancelFirst := context.WithCancel(context.Background())
+				assert.True(t, r.Attach(firstCtx))
+
+				secondCtx, cancelSecond := context.WithCancel(context.Background())
+				assert.True(t, r.Attach(secondCtx))
+
+				cancelFirst()
+				synctest.Wait()
+				assert.NoError(t, shared.Err())
+
+				// late caller joins the in-flight work
+				thirdCtx, cancelThird := context.WithCancel(context.Background())
+				assert.True(t, r.Attach(thirdCtx))
+
+				cancelSecond()
+				synctest.Wait()
+				assert.NoError(t, shared.Err())
+
+				cancelThird()
+				synctest.Wait()
+				assert.ErrorIs(t, shared.Err(), context.Canceled)
+
+				assert.False(t, r.Attach(context.Background()), "Attach should fail once the shared context is done")
+			},
+			description: "Refcount should end with its last attached context",
+		},
+		{
+			name: "attach as the last caller leaves",
+			verify: func(t *testing.T, srvCtx context.Context, _ context.CancelFunc) {
+				r := NewRefcount(srvCtx)
+
+				// attach a new caller right after the last one is detached,
+				// before the shared context is canceled
+				var attached bool
+				leavingCtx, leave := context.WithCancel(context.Background())
+				hooked := &hookedCtx{Context: leavingCtx}
+				hooked.onErr = func() { attached = r.Attach(context.Background()) }
+				assert.True(t, r.Attach(hooked))
+
+				leave()
+				synctest.Wait()
+				assert.ErrorIs(t, r.Context().Err(), context.Canceled)
+				assert.False(t, attached, "Attach should fail once the context is ending")
+			},
+			description: "A caller arriving as the last one leaves should not be attached",
+		},
+		{
+			name: "parent ends shared context",
+			verify: func(t *testing.T, srvCtx context.Context, shutdown context.CancelFunc) {
+				r := NewRefcount(srvCtx)
+				assert.True(t, r.Attach(context.Background()))
+
+				shutdown()
+				synctest.Wait()
+				assert.ErrorIs(t, r.Context().Err(), context.Canceled)
+			},
+			description: "Shared context should not outlive its parent",
+		},
+		{
+			name: "cancel",
+			verify: func(t *testing.T, srvCtx context.Context, _ context.CancelFunc) {
+				r := NewRefcount(srvCtx)
+				assert.True(t, r.Attach(context.Background()))
+
+				r.Cancel()
+				assert.ErrorIs(t, r.Context().Err(), context.Canceled)
+			},
+			description: "Cancel should end the shared context regardless of attached contexts",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				srvCtx, shutdown := context.WithCancel(SetTraceID(context.Background(), "trace-server"))
+				defer shutdown()
+
+				tc.verify(t, srvCtx, shutdown)
+			})
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package ctxutil
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// OutstandingCancel is a CancelFunc returned by one of the package's
+// constructors that hasn't been called yet, see SetLeakDetection.
+type OutstandingCancel struct {
+	Operation string // constructor that returned the CancelFunc
+	Stack     string // where the constructor was called
+	id        uint64
+}
+
+// leaks tracks the outstanding CancelFuncs while leak detection is on.
+var leaks struct {
+	enabled atomic.Bool
+	lastID  atomic.Uint64
+
+	mu          sync.Mutex
+	outstanding map[uint64]OutstandingCancel
+}
+
+// SetLeakDetection turns tracking of the CancelFuncs returned by the
+// package's constructors on or off. While it's on, each constructor records
+// its call stack, which is costly, so it's meant for tests and debugging.
+// CancelFuncs returned while it was off are never reported.
+func SetLeakDetection(enabled bool) {
+	leaks.enabled.Store(enabled)
+}
+
+// OutstandingCancels returns the tracked CancelFuncs that haven't been
+// called yet, oldest first.
+func OutstandingCancels() []OutstandingCancel {
+	leaks.mu.Lock()
+	defer leaks.mu.Unlock()
+
+	cancels := make([]OutstandingCancel, 0, len(leaks.outstanding))
+	for _, c := range leaks.outstanding {
+		cancels = append(cancels, c)
+	}
+	slices.SortFunc(cancels, func(a, b OutstandingCancel) int { return cmp.Compare(a.id, b.id) })
+	return cancels
+}
+
+// TB is the part of testing.TB used by CheckCancels.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Cleanup(func())
+}
+
+// CheckCancels turns leak detection on for the rest of the test and fails
+// it if any CancelFunc returned in the meantime wasn't called by the time
+// the test and its cleanups finish. It can't tell which test created a
+// CancelFunc, so it's best used in tests that don't run in parallel.
+func CheckCancels(t TB) {
+	t.Helper()
+
+	wasEnabled := leaks.enabled.Swap(true)
+	since := leaks.lastID.Load()
+
+	t.Cleanup(func() {
+		t.Helper()
+
+		leaks.enabled.Store(wasEnabled)
+		for _, c := range OutstandingCancels() {
+			if c.id > since {
+				t.Errorf("ctxutil: CancelFunc returned by %s was not called, created at:\n%s", c.Operation, c.Stack)
+			}
+		}
+	})
+}
+
+// track records cancel as outstanding until it's called,
+// if leak detection is on.
+func track(operation string, cancel context.CancelFunc) context.CancelFunc {
+	if !leaks.enabled.Load() {
+		return cancel
+	}
+
+	id := leaks.lastID.Add(1)
+	leaks.mu.Lock()
+	if leaks.outstanding == nil {
+		leaks.outstanding = make(map[uint64]OutstandingCancel)
+	}
+	leaks.outstanding[id] = OutstandingCancel{Operation: operation, Stack: callers(), id: id}
+	leaks.mu.Unlock()
+
+	return func() {
+		leaks.mu.Lock()
+		delete(leaks.outstanding, id)
+		leaks.mu.Unlock()
+
+		cancel()
+	}
+}
+
+// callers formats the call stack above track.
+func callers() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,129 @@
+package ctxutil
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTB records the failures reported through TB.
+type fakeTB struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+
+// finish runs the cleanups like the testing package does.
+func (f *fakeTB) finish() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+// not parallel: toggles the package leak detection
+func TestOutstandingCancels(t *testing.T) {
+	t.Cleanup(func() { SetLeakDetection(false) })
+
+	_, cancelUntracked := ExtendTimeout(context.Background(), time.Hour)
+	defer cancelUntracked()
+
+	SetLeakDetection(true)
+	before := len(OutstandingCancels())
+
+	_, cancelTimeout := ExtendTimeout(context.Background(), time.Hour)
+	_, _, cancelLease := WithLease(context.Background(), time.Hour)
+
+	outstanding := OutstandingCancels()[before:]
+	require.Len(t, outstanding, 2, "Untracked CancelFuncs should not be reported")
+	assert.Equal(t, "ExtendTimeout", outstanding[0].Operation)
+	assert.Equal(t, "WithLease", outstanding[1].Operation)
+	assert.Contains(t, outstanding[0].Stack, "TestOutstandingCancels", "Stack should lead to the caller")
+
+	cancelTimeout()
+	cancelTimeout()
+	require.Len(t, OutstandingCancels()[before:], 1)
+
+	cancelLease()
+	assert.Len(t, OutstandingCancels(), before)
+}
+
+// not parallel: toggles the package leak detection
+func TestOutstandingCancelsWithoutDeadline(t *testing.T) {
+	t.Cleanup(func() { SetLeakDetection(false) })
+
+	SetLeakDetection(true)
+	before := len(OutstandingCancels())
+
+	_, cancelReserve := Reserve(context.Background(), time.Second)
+	_, cancelSplit := Split(context.Background(), 0.5)
+	_, cancelNext := NewSequence(context.Background(), 1).Next()
+
+	var operations []string
+	for _, o := range OutstandingCancels()[before:] {
+		operations = append(operations, o.Operation)
+	}
+	assert.Equal(t, []string{"Reserve", "Split", "Sequence"}, operations, "CancelFuncs without deadline should be tracked too")
+
+	cancelReserve()
+	cancelSplit()
+	cancelNext()
+	assert.Len(t, OutstandingCancels(), before)
+}
+
+// not parallel: toggles the package leak detection
+func TestCheckCancels(t *testing.T) {
+	testCases := []struct {
+		name        string
+		run         func()
+		expected    int
+		description string
+	}{
+		{
+			name: "all canceled",
+			run: func() {
+				_, cancel := ExtendTimeout(context.Background(), time.Hour)
+				defer cancel()
+
+				_, cancelSplit := Split(context.Background(), 0.5, 0.5)
+				defer cancelSplit()
+			},
+			expected:    0,
+			description: "Tests that call every CancelFunc should pass",
+		},
+		{
+			name: "forgotten cancel",
+			run: func() {
+				ExtendTimeout(context.Background(), time.Hour)
+			},
+			expected:    1,
+			description: "Forgotten CancelFuncs should fail the test",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeTB{}
+			CheckCancels(fake)
+			tc.run()
+			fake.finish()
+
+			require.Len(t, fake.errors, tc.expected, tc.description)
+			for _, msg := range fake.errors {
+				assert.Contains(t, msg, "ExtendTimeout")
+				assert.Contains(t, msg, "TestCheckCancels")
+			}
+			assert.False(t, leaks.enabled.Load(), "Leak detection should be restored")
+		})
+	}
+}
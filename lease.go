@@ -0,0 +1,24 @@
+package ctxutil
+
+import (
+	"context"
+	"time"
+)
+
+// WithLease creates a fresh context that ends ttl after the last renewal,
+// for long-running jobs that should live as long as they make progress.
+// Like ExtendTimeout, it carries over the known values of the original
+// context and ignores its deadline and cancellation.
+// Each call to renew pushes the deadline to ttl from now, and Deadline
+// reflects the latest value. Renewals reuse a single timer.
+// Renewing after the lease expired or was canceled has no effect.
+func WithLease(ctx context.Context, ttl time.Duration, opts ...Option) (context.Context, func(), context.CancelFunc) {
+	o := newOptions(opts)
+	clock := clockFrom(ctx)
+	c := newRecordedTimerCtx(detach(ctx), o.label, "WithLease", o.timeoutCause(ctx, "WithLease", ttl), clock)
+
+	renew := func() { c.setDeadline(clock.Now().Add(ttl)) }
+	renew()
+
+	return c, renew, track("WithLease", func() { c.cancel(context.Canceled) })
+}
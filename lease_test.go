@@ -0,0 +1,99 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithLease(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, context.Context, func(), context.CancelFunc)
+		description string
+	}{
+		{
+			name: "values are preserved",
+			verify: func(t *testing.T, ctx context.Context, _ func(), _ context.CancelFunc) {
+				assert.Equal(t, "device-lease", GetDeviceID(ctx), "Device ID should be preserved")
+			},
+			description: "Values should carry over like in ExtendTimeout",
+		},
+		{
+			name: "expires without renewal",
+			verify: func(t *testing.T, ctx context.Context, _ func(), _ context.CancelFunc) {
+				time.Sleep(10 * time.Second)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+				var timeoutErr *TimeoutError
+				require.ErrorAs(t, context.Cause(ctx), &timeoutErr)
+				assert.Equal(t, "WithLease", timeoutErr.Operation)
+				assert.Equal(t, 10*time.Second, timeoutErr.Budget)
+			},
+			description: "A lease that isn't renewed should expire after ttl",
+		},
+		{
+			name: "renewal pushes deadline out",
+			verify: func(t *testing.T, ctx context.Context, renew func(), _ context.CancelFunc) {
+				for range 5 {
+					time.Sleep(9 * time.Second)
+					renew()
+
+					deadline, ok := ctx.Deadline()
+					assert.True(t, ok)
+					assert.Equal(t, 10*time.Second, time.Until(deadline), "Deadline should reflect the latest renewal")
+				}
+				synctest.Wait()
+				assert.NoError(t, ctx.Err(), "Renewed lease should outlive its initial ttl")
+
+				time.Sleep(10 * time.Second)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+			},
+			description: "Each renewal should extend the deadline by ttl",
+		},
+		{
+			name: "renewal after expiry has no effect",
+			verify: func(t *testing.T, ctx context.Context, renew func(), _ context.CancelFunc) {
+				time.Sleep(10 * time.Second)
+				synctest.Wait()
+				renew()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+			},
+			description: "An expired lease stays expired",
+		},
+		{
+			name: "cancel ends the lease",
+			verify: func(t *testing.T, ctx context.Context, renew func(), cancel context.CancelFunc) {
+				cancel()
+				renew()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+			},
+			description: "Cancel should end the lease right away",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				parentCtx, cancelParent := context.WithTimeout(context.Background(), time.Second)
+				defer cancelParent()
+				parentCtx = SetDeviceID(parentCtx, "device-lease")
+
+				ctx, renew, cancel := WithLease(parentCtx, 10*time.Second)
+				defer cancel()
+
+				tc.verify(t, ctx, renew, cancel)
+			})
+		})
+	}
+}
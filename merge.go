@@ -0,0 +1,250 @@
+package ctxutil
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Precedence decides which input of Merge a value is taken from
+// when several of them set it.
+type Precedence int
+
+const (
+	// FirstWins takes the value from the first input that sets it.
+	FirstWins Precedence = iota
+	// LastWins takes the value from the last input that sets it.
+	LastWins
+)
+
+// MergeField names a group of ctxutil values that can be given
+// its own precedence in a MergePolicy.
+type MergeField string
+
+const (
+	MergeDeviceID    MergeField = "device_id"
+	MergeTraceID     MergeField = "trace_id"
+	MergeRequestID   MergeField = "request_id"
+	MergeFlags       MergeField = "flags"       // flags and flag provider
+	MergeExperiments MergeField = "experiments" // assignments and overrides
+	MergeIDGenerator MergeField = "id_generator"
+	MergeClock       MergeField = "clock"
+)
+
+// MergePolicy configures how MergeWith combines the values of its inputs.
+// Fields without an entry in Fields, and values not managed by ctxutil,
+// follow Default.
+type MergePolicy struct {
+	Default Precedence
+	Fields  map[MergeField]Precedence
+}
+
+// precedence returns the precedence of the field.
+func (p MergePolicy) precedence(field MergeField) Precedence {
+	if prec, ok := p.Fields[field]; ok {
+		return prec
+	}
+	return p.Default
+}
+
+// Merge creates a context that is done as soon as any of ctxs is done,
+// such as a request context merged with a server shutdown context.
+// It reports the error and cause of the input that ended it, and the
+// earliest deadline of its inputs. Values set by more than one input are
+// taken from the first one, see MergeWith to choose otherwise.
+func Merge(ctxs ...context.Context) (context.Context, context.CancelFunc) {
+	return MergeWith(MergePolicy{}, ctxs...)
+}
+
+// MergeWith is like Merge, but combines the values of the inputs
+// according to the policy.
+func MergeWith(policy MergePolicy, ctxs ...context.Context) (context.Context, context.CancelFunc) {
+	c := &mergedCtx{
+		errCtx: newErrCtx(context.Background()),
+		inputs: ordered(policy.Default, ctxs),
+		vals:   mergeValues(policy, ctxs),
+	}
+
+	for _, in := range ctxs {
+		if in.Err() != nil {
+			c.cancel(in.Err(), context.Cause(in))
+			break
+		}
+		stop := afterDone(in, func() {
+			c.cancel(in.Err(), context.Cause(in))
+		})
+
+		c.mu.Lock()
+		done := c.errCtx.Err() != nil
+		if !done {
+			c.stops = append(c.stops, stop)
+		}
+		c.mu.Unlock()
+
+		if done {
+			stop()
+			break
+		}
+	}
+
+	return c, track("Merge", func() { c.cancel(context.Canceled, context.Canceled) })
+}
+
+// mergedCtx is done when any of its inputs is done, with its error,
+// which contexts derived from it see too.
+type mergedCtx struct {
+	*errCtx
+	inputs []context.Context // in value lookup order
+	vals   *contextValues
+
+	mu    sync.Mutex
+	stops []func() bool
+}
+
+// Deadline returns the earliest deadline of the inputs.
+func (c *mergedCtx) Deadline() (deadline time.Time, ok bool) {
+	for _, in := range c.inputs {
+		if d, has := in.Deadline(); has && (!ok || d.Before(deadline)) {
+			deadline, ok = d, true
+		}
+	}
+	return deadline, ok
+}
+
+// Value returns the merged ctxutil values, and looks up
+// any other key in the inputs in precedence order.
+func (c *mergedCtx) Value(key any) any {
+	if key == (contextKey{}) {
+		return c.vals
+	}
+	// the cancellation state, which context.Cause looks up
+	if v := c.errCtx.Value(key); v != nil {
+		return v
+	}
+	for _, in := range c.inputs {
+		if v := in.Value(key); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// cancel ends the context with err and cause, unless it's already done,
+// and stops watching the inputs.
+func (c *mergedCtx) cancel(err, cause error) {
+	if !c.finish(err, cause) {
+		return
+	}
+
+	c.mu.Lock()
+	stops := c.stops
+	c.stops = nil
+	c.mu.Unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+}
+
+// ordered returns ctxs in the order their values are looked up.
+func ordered(prec Precedence, ctxs []context.Context) []context.Context {
+	ctxs = slices.Clone(ctxs)
+	if prec == LastWins {
+		slices.Reverse(ctxs)
+	}
+	return ctxs
+}
+
+// mergeValues combines the ctxutil values of ctxs into a fresh store.
+func mergeValues(policy MergePolicy, ctxs []context.Context) *contextValues {
+	inputs := make([]*contextValues, len(ctxs))
+	for i, ctx := range ctxs {
+		inputs[i] = getValues(ctx)
+	}
+
+	// first returns the first non-zero value of field, in precedence order
+	first := func(field MergeField, get func(*contextValues) any) any {
+		vals := inputs
+		if policy.precedence(field) == LastWins {
+			vals = slices.Clone(inputs)
+			slices.Reverse(vals)
+		}
+		for _, v := range vals {
+			v.mu.Lock()
+			value := get(v)
+			v.mu.Unlock()
+			if value != nil {
+				return value
+			}
+		}
+		return nil
+	}
+	str := func(field MergeField, get func(*contextValues) string) string {
+		s, _ := first(field, func(v *contextValues) any {
+			if s := get(v); s != "" {
+				return s
+			}
+			return nil
+		}).(string)
+		return s
+	}
+	// merged combines the maps of field key by key, in precedence order
+	merged := func(field MergeField, get func(*contextValues) map[string]string) map[string]string {
+		var out map[string]string
+		first(field, func(v *contextValues) any {
+			for k, value := range get(v) {
+				if out == nil {
+					out = make(map[string]string)
+				}
+				if _, ok := out[k]; !ok {
+					out[k] = value
+				}
+			}
+			return nil
+		})
+		return out
+	}
+
+	out := &contextValues{
+		deviceID:  str(MergeDeviceID, func(v *contextValues) string { return v.deviceID }),
+		traceID:   str(MergeTraceID, func(v *contextValues) string { return v.traceID }),
+		requestID: str(MergeRequestID, func(v *contextValues) string { return v.requestID }),
+	}
+
+	first(MergeFlags, func(v *contextValues) any {
+		for name, value := range v.flags {
+			if out.flags == nil {
+				out.flags = make(map[string]any)
+			}
+			if _, ok := out.flags[name]; !ok {
+				out.flags[name] = value
+			}
+		}
+		return nil
+	})
+	out.flagProvider, _ = first(MergeFlags, func(v *contextValues) any {
+		if v.flagProvider == nil {
+			return nil
+		}
+		return v.flagProvider
+	}).(FlagProvider)
+
+	out.assignments = merged(MergeExperiments, func(v *contextValues) map[string]string { return v.assignments })
+	out.overrides = merged(MergeExperiments, func(v *contextValues) map[string]string { return v.overrides })
+
+	out.idGenerator, _ = first(MergeIDGenerator, func(v *contextValues) any {
+		if v.idGenerator == nil {
+			return nil
+		}
+		return v.idGenerator
+	}).(IDGenerator)
+	out.clock, _ = first(MergeClock, func(v *contextValues) any {
+		if v.clock == nil {
+			return nil
+		}
+		return v.clock
+	}).(Clock)
+
+	return out
+}
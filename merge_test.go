@@ -0,0 +1,220 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	errShutdown := errors.New("server shutting down")
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T)
+		description string
+	}{
+		{
+			name: "first done input ends the merge",
+			verify: func(t *testing.T) {
+				reqCtx, cancelReq := context.WithCancel(context.Background())
+				defer cancelReq()
+				srvCtx, shutdown := context.WithCancelCause(context.Background())
+
+				ctx, cancel := Merge(reqCtx, srvCtx)
+				defer cancel()
+
+				assert.NoError(t, ctx.Err())
+
+				shutdown(errShutdown)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+				assert.ErrorIs(t, context.Cause(ctx), errShutdown, "Cause should come from the input that ended the merge")
+
+				cancelReq()
+				assert.ErrorIs(t, context.Cause(ctx), errShutdown, "Later inputs should not replace the cause")
+			},
+			description: "Merge should end when any input ends",
+		},
+		{
+			name: "deadline",
+			verify: func(t *testing.T) {
+				shortCtx, cancelShort := context.WithTimeout(context.Background(), time.Second)
+				defer cancelShort()
+				longCtx, cancelLong := context.WithTimeout(context.Background(), time.Minute)
+				defer cancelLong()
+
+				ctx, cancel := Merge(longCtx, shortCtx)
+				defer cancel()
+
+				deadline, ok := ctx.Deadline()
+				assert.True(t, ok)
+				assert.Equal(t, time.Second, time.Until(deadline), "Earliest deadline should win")
+
+				time.Sleep(time.Second)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded, "Err should come from the input that ended the merge")
+			},
+			description: "Merge should report the earliest deadline",
+		},
+		{
+			name: "derived contexts see the error",
+			verify: func(t *testing.T) {
+				shortCtx, cancelShort := context.WithTimeout(context.Background(), time.Second)
+				defer cancelShort()
+
+				ctx, cancel := Merge(context.Background(), shortCtx)
+				defer cancel()
+				child, cancelChild := context.WithCancel(ctx)
+				defer cancelChild()
+
+				time.Sleep(time.Second)
+				synctest.Wait()
+				assert.ErrorIs(t, child.Err(), context.DeadlineExceeded, "Children should not report a plain cancellation")
+			},
+			description: "Contexts derived from a merge should see its error",
+		},
+		{
+			name: "no deadline",
+			verify: func(t *testing.T) {
+				ctx, cancel := Merge(context.Background(), context.Background())
+				defer cancel()
+
+				_, ok := ctx.Deadline()
+				assert.False(t, ok)
+			},
+			description: "Merge of contexts without deadline has none",
+		},
+		{
+			name: "already done input",
+			verify: func(t *testing.T) {
+				doneCtx, cancelDone := context.WithCancelCause(context.Background())
+				cancelDone(errShutdown)
+
+				ctx, cancel := Merge(context.Background(), doneCtx)
+				defer cancel()
+
+				assert.ErrorIs(t, ctx.Err(), context.Canceled, "Merge should be done right away")
+				assert.ErrorIs(t, context.Cause(ctx), errShutdown)
+			},
+			description: "Merging a done context should return a done context",
+		},
+		{
+			name: "cancel",
+			verify: func(t *testing.T) {
+				inCtx, cancelIn := context.WithCancelCause(context.Background())
+				defer cancelIn(nil)
+
+				ctx, cancel := Merge(inCtx)
+				cancel()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+				cancelIn(errShutdown)
+				synctest.Wait()
+				assert.ErrorIs(t, context.Cause(ctx), context.Canceled, "Inputs should not be watched after cancel")
+			},
+			description: "Cancel should end the merge",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				tc.verify(t)
+			})
+		})
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	t.Parallel()
+
+	type foreignKey struct{}
+
+	reqCtx := SetTraceID(context.Background(), "trace-req")
+	reqCtx = SetDeviceID(reqCtx, "device-req")
+	reqCtx = SetFlags(reqCtx, map[string]bool{"beta": true, "dark-mode": true})
+	reqCtx = context.WithValue(reqCtx, foreignKey{}, "req")
+
+	srvCtx := SetTraceID(context.Background(), "trace-srv")
+	srvCtx = SetRequestID(srvCtx, "request-srv")
+	srvCtx = SetFlags(srvCtx, map[string]bool{"beta": false, "audit": true})
+	srvCtx = context.WithValue(srvCtx, foreignKey{}, "srv")
+
+	testCases := []struct {
+		name            string
+		policy          MergePolicy
+		expectedTraceID string
+		expectedDevice  string
+		expectedBeta    bool
+		expectedForeign string
+		description     string
+	}{
+		{
+			name:            "first wins",
+			policy:          MergePolicy{Default: FirstWins},
+			expectedTraceID: "trace-req",
+			expectedDevice:  "device-req",
+			expectedBeta:    true,
+			expectedForeign: "req",
+			description:     "Values should come from the first input that sets them",
+		},
+		{
+			name:            "last wins",
+			policy:          MergePolicy{Default: LastWins},
+			expectedTraceID: "trace-srv",
+			expectedDevice:  "device-req",
+			expectedBeta:    false,
+			expectedForeign: "srv",
+			description:     "Values should come from the last input that sets them",
+		},
+		{
+			name: "per field",
+			policy: MergePolicy{
+				Default: FirstWins,
+				Fields:  map[MergeField]Precedence{MergeTraceID: LastWins},
+			},
+			expectedTraceID: "trace-srv",
+			expectedDevice:  "device-req",
+			expectedBeta:    true,
+			expectedForeign: "req",
+			description:     "Fields with their own precedence should override the default",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := MergeWith(tc.policy, reqCtx, srvCtx)
+			defer cancel()
+
+			assert.Equal(t, tc.expectedTraceID, GetTraceID(ctx), tc.description)
+			assert.Equal(t, tc.expectedDevice, GetDeviceID(ctx), "Values set by one input only should be kept")
+			assert.Equal(t, "request-srv", GetRequestID(ctx), "Values set by one input only should be kept")
+			assert.Equal(t, tc.expectedForeign, ctx.Value(foreignKey{}), "Foreign values should follow the default precedence")
+
+			beta, ok := Flag[bool](ctx, "beta")
+			assert.True(t, ok)
+			assert.Equal(t, tc.expectedBeta, beta)
+
+			for _, name := range []string{"dark-mode", "audit"} {
+				enabled, ok := Flag[bool](ctx, name)
+				assert.True(t, ok && enabled, "Flags should be merged by name")
+			}
+
+			// the merged store is separate from the inputs
+			SetTraceID(ctx, "trace-merged")
+			assert.Equal(t, "trace-req", GetTraceID(reqCtx))
+			assert.Equal(t, "trace-srv", GetTraceID(srvCtx))
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package ctxutil
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Option configures the contexts created by the package's constructors.
+type Option func(*options)
+
+type options struct {
+	cause error
+	label string
+}
+
+// newOptions applies opts over the defaults.
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithCause sets the error reported by context.Cause when the context
+// reaches its deadline, instead of the default *TimeoutError.
+func WithCause(cause error) Option {
+	return func(o *options) { o.cause = cause }
+}
+
+// WithLabel names the deadline set by the constructor, such as "db",
+// as reported by ExplainDeadline.
+func WithLabel(label string) Option {
+	return func(o *options) { o.label = label }
+}
+
+// TimeoutError is the default cancellation cause of contexts created by the
+// package that reach their deadline. It wraps context.DeadlineExceeded.
+type TimeoutError struct {
+	Operation string        // constructor that created the context
+	Budget    time.Duration // time the context was given
+	TraceID   string
+	DeviceID  string
+}
+
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("ctxutil: %s timed out after %s", e.Operation, e.Budget)
+	if e.TraceID != "" {
+		msg += " trace_id=" + e.TraceID
+	}
+	if e.DeviceID != "" {
+		msg += " device_id=" + e.DeviceID
+	}
+	return msg
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// timeoutCause returns the configured cause, or a *TimeoutError
+// describing the operation and the values of ctx.
+func (o options) timeoutCause(ctx context.Context, operation string, budget time.Duration) error {
+	if o.cause != nil {
+		return o.cause
+	}
+	vals := getValues(ctx)
+	return &TimeoutError{
+		Operation: operation,
+		Budget:    budget,
+		TraceID:   vals.traceID,
+		DeviceID:  vals.deviceID,
+	}
+}
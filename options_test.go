@@ -0,0 +1,158 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutCause(t *testing.T) {
+	t.Parallel()
+
+	errShutdown := errors.New("server shutting down")
+
+	type constructor func(context.Context, ...Option) (context.Context, context.CancelFunc)
+
+	constructors := []struct {
+		operation string
+		construct constructor
+	}{
+		{
+			operation: "ExtendTimeout",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				return ExtendTimeout(ctx, time.Second, opts...)
+			},
+		},
+		{
+			operation: "ExtendTimeoutKeepAll",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				return ExtendTimeoutKeepAll(ctx, time.Second, opts...)
+			},
+		},
+		{
+			operation: "ExtendTimeoutLinked",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				return ExtendTimeoutLinked(ctx, time.Second, opts...)
+			},
+		},
+		{
+			operation: "ExtendDeadline",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				return ExtendDeadline(ctx, time.Now().Add(time.Second), opts...)
+			},
+		},
+		{
+			operation: "CapTimeout",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				return CapTimeout(ctx, time.Second, opts...)
+			},
+		},
+		{
+			operation: "FloorTimeout",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				return FloorTimeout(ctx, time.Second, opts...)
+			},
+		},
+		{
+			operation: "Reserve",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+				reserved, cancelReserved := Reserve(ctx, time.Second, opts...)
+				return reserved, func() { cancelReserved(); cancel() }
+			},
+		},
+		{
+			operation: "Split",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+				ctxs, cancelSplit := SplitWith(ctx, opts, 0.5)
+				return ctxs[0], func() { cancelSplit(); cancel() }
+			},
+		},
+		{
+			operation: "Sequence",
+			construct: func(ctx context.Context, opts ...Option) (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+				next, cancelNext := NewSequence(ctx, 1, 1).Next(opts...)
+				return next, func() { cancelNext(); cancel() }
+			},
+		},
+	}
+
+	for _, c := range constructors {
+		t.Run(c.operation, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				ctx := SetTraceID(context.Background(), "trace-cause")
+				ctx = SetDeviceID(ctx, "device-cause")
+
+				// default cause describes the timeout
+				newCtx, cancel := c.construct(ctx)
+				defer cancel()
+				time.Sleep(time.Second)
+				synctest.Wait()
+
+				assert.ErrorIs(t, newCtx.Err(), context.DeadlineExceeded)
+
+				var timeoutErr *TimeoutError
+				require.ErrorAs(t, context.Cause(newCtx), &timeoutErr)
+				assert.Equal(t, &TimeoutError{
+					Operation: c.operation,
+					Budget:    time.Second,
+					TraceID:   "trace-cause",
+					DeviceID:  "device-cause",
+				}, timeoutErr)
+				assert.ErrorIs(t, timeoutErr, context.DeadlineExceeded, "TimeoutError should wrap DeadlineExceeded")
+
+				// custom cause wins
+				newCtx, cancel = c.construct(ctx, WithCause(errShutdown))
+				defer cancel()
+				time.Sleep(time.Second)
+				synctest.Wait()
+
+				assert.ErrorIs(t, newCtx.Err(), context.DeadlineExceeded)
+				assert.ErrorIs(t, context.Cause(newCtx), errShutdown)
+			})
+		})
+	}
+}
+
+func TestTimeoutErrorMessage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		err      *TimeoutError
+		expected string
+	}{
+		{
+			name:     "without IDs",
+			err:      &TimeoutError{Operation: "ExtendTimeout", Budget: time.Second},
+			expected: "ctxutil: ExtendTimeout timed out after 1s",
+		},
+		{
+			name: "with IDs",
+			err: &TimeoutError{
+				Operation: "Split",
+				Budget:    250 * time.Millisecond,
+				TraceID:   "trace-1",
+				DeviceID:  "device-1",
+			},
+			expected: "ctxutil: Split timed out after 250ms trace_id=trace-1 device_id=device-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, tc.err.Error())
+		})
+	}
+}
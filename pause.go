@@ -0,0 +1,88 @@
+package ctxutil
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PausableContext is a context with a processing budget whose clock can be
+// stopped, for flows that wait on the user (e.g. for a 2FA code) and
+// shouldn't be charged for that time.
+type PausableContext struct {
+	*timerCtx
+	budget time.Duration
+
+	mu        sync.Mutex
+	consumed  time.Duration // budget used up to the last pause
+	resumedAt time.Time     // zero while paused
+}
+
+// WithPausableTimeout creates a fresh context with the given budget that
+// starts running right away.
+// Like ExtendTimeout, it carries over the known values of the original
+// context and ignores its deadline and cancellation.
+// While paused, the context has no deadline.
+func WithPausableTimeout(ctx context.Context, budget time.Duration, opts ...Option) (*PausableContext, context.CancelFunc) {
+	o := newOptions(opts)
+	c := &PausableContext{
+		timerCtx: newRecordedTimerCtx(detach(ctx), o.label, "WithPausableTimeout", o.timeoutCause(ctx, "WithPausableTimeout", budget), clockFrom(ctx)),
+		budget:   budget,
+	}
+	c.Resume()
+
+	return c, track("WithPausableTimeout", func() { c.cancel(context.Canceled) })
+}
+
+// Pause stops the clock. It has no effect if the context is already paused.
+func (c *PausableContext) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resumedAt.IsZero() {
+		return
+	}
+	c.consumed = min(c.consumed+c.clock.Now().Sub(c.resumedAt), c.budget)
+	c.resumedAt = time.Time{}
+
+	if c.consumed < c.budget {
+		c.clearDeadline()
+	}
+}
+
+// Resume restarts the clock, moving the deadline to account for the time
+// spent paused. It has no effect if the context is already running.
+func (c *PausableContext) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.resumedAt.IsZero() {
+		return
+	}
+	c.resumedAt = c.clock.Now()
+	c.setDeadline(c.resumedAt.Add(c.budget - c.consumed))
+}
+
+// Paused reports whether the clock is stopped.
+func (c *PausableContext) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.resumedAt.IsZero()
+}
+
+// Consumed returns how much of the budget has been used, not counting pauses.
+func (c *PausableContext) Consumed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resumedAt.IsZero() {
+		return c.consumed
+	}
+	return min(c.consumed+c.clock.Now().Sub(c.resumedAt), c.budget)
+}
+
+// Remaining returns how much of the budget is left.
+func (c *PausableContext) Remaining() time.Duration {
+	return c.budget - c.Consumed()
+}
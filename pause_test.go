@@ -0,0 +1,116 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPausableTimeout(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, *PausableContext, context.CancelFunc)
+		description string
+	}{
+		{
+			name: "values are preserved",
+			verify: func(t *testing.T, ctx *PausableContext, _ context.CancelFunc) {
+				assert.Equal(t, "device-pause", GetDeviceID(ctx), "Device ID should be preserved")
+			},
+			description: "Values should carry over like in ExtendTimeout",
+		},
+		{
+			name: "runs out without pauses",
+			verify: func(t *testing.T, ctx *PausableContext, _ context.CancelFunc) {
+				deadline, ok := ctx.Deadline()
+				assert.True(t, ok)
+				assert.Equal(t, 10*time.Second, time.Until(deadline))
+
+				time.Sleep(10 * time.Second)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+				assert.Equal(t, 10*time.Second, ctx.Consumed())
+				assert.Zero(t, ctx.Remaining())
+			},
+			description: "The budget should behave like a timeout while running",
+		},
+		{
+			name: "paused time is not charged",
+			verify: func(t *testing.T, ctx *PausableContext, _ context.CancelFunc) {
+				time.Sleep(4 * time.Second)
+				ctx.Pause()
+				assert.True(t, ctx.Paused())
+
+				_, ok := ctx.Deadline()
+				assert.False(t, ok, "Paused context has no deadline")
+
+				// waiting on the user for longer than the whole budget
+				time.Sleep(time.Minute)
+				synctest.Wait()
+				assert.NoError(t, ctx.Err(), "Time spent paused should not count")
+				assert.Equal(t, 4*time.Second, ctx.Consumed())
+
+				ctx.Resume()
+				assert.False(t, ctx.Paused())
+				deadline, ok := ctx.Deadline()
+				assert.True(t, ok)
+				assert.Equal(t, 6*time.Second, time.Until(deadline), "Deadline should be recomputed on resume")
+
+				time.Sleep(5 * time.Second)
+				assert.Equal(t, 9*time.Second, ctx.Consumed())
+				assert.Equal(t, time.Second, ctx.Remaining())
+
+				time.Sleep(time.Second)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+			},
+			description: "Only running time should count against the budget",
+		},
+		{
+			name: "repeated pause and resume are idempotent",
+			verify: func(t *testing.T, ctx *PausableContext, _ context.CancelFunc) {
+				time.Sleep(time.Second)
+				ctx.Pause()
+				time.Sleep(time.Second)
+				ctx.Pause()
+				ctx.Resume()
+				time.Sleep(time.Second)
+				ctx.Resume()
+				assert.Equal(t, 2*time.Second, ctx.Consumed())
+			},
+			description: "Pausing a paused context or resuming a running one changes nothing",
+		},
+		{
+			name: "cancel while paused",
+			verify: func(t *testing.T, ctx *PausableContext, cancel context.CancelFunc) {
+				ctx.Pause()
+				cancel()
+				ctx.Resume()
+				time.Sleep(time.Minute)
+				synctest.Wait()
+				assert.ErrorIs(t, ctx.Err(), context.Canceled)
+			},
+			description: "Cancel should end the context for good",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				parentCtx := SetDeviceID(context.Background(), "device-pause")
+
+				ctx, cancel := WithPausableTimeout(parentCtx, 10*time.Second)
+				defer cancel()
+
+				tc.verify(t, ctx, cancel)
+			})
+		})
+	}
+}
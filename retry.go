@@ -0,0 +1,119 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRetryDeadline is returned by Retry when the time left before the
+// deadline is too short for another attempt. It wraps the last error.
+var ErrRetryDeadline = errors.New("ctxutil: not enough time left for another attempt")
+
+// Defaults for the zero fields of a RetryPolicy.
+const (
+	DefaultMaxAttempts = 3
+	DefaultBaseDelay   = 100 * time.Millisecond
+	DefaultMaxDelay    = 10 * time.Second
+)
+
+// RetryPolicy configures Retry.
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, DefaultMaxAttempts if zero
+	BaseDelay   time.Duration // backoff before the second attempt, DefaultBaseDelay if zero
+	MaxDelay    time.Duration // backoff cap, DefaultMaxDelay if zero
+
+	// Retryable reports whether an attempt that failed with err should be
+	// retried. If nil, every error is retried.
+	Retryable func(err error) bool
+
+	// MinRemaining is the least time that must be left before the context's
+	// deadline for an attempt to start.
+	MinRemaining time.Duration
+}
+
+type attemptKey struct{}
+
+// Attempt returns the number of the current Retry or Hedge attempt,
+// starting at 1, or 0 if the context doesn't come from either.
+func Attempt(ctx context.Context) int {
+	n, _ := ctx.Value(attemptKey{}).(int)
+	return n
+}
+
+// Retry calls fn until it succeeds, the error isn't retryable, the attempts
+// run out or the context is done, and returns the last error.
+// Attempts are spaced with exponential backoff and full jitter: the wait
+// before attempt n+1 is random between zero and BaseDelay*2^(n-1), capped
+// at MaxDelay. No attempt starts, and no wait begins, when the time left
+// before the deadline would be shorter than MinRemaining; Retry returns
+// an ErrRetryDeadline instead.
+// The attempt number is available to fn through Attempt.
+// Waits use the context's clock and the package's random source.
+func Retry(ctx context.Context, fn func(context.Context) error, policy RetryPolicy) error {
+	policy = policy.withDefaults()
+	clock := clockFrom(ctx)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if left, ok := Remaining(ctx); ok && left < policy.MinRemaining {
+			return retryDeadline(err)
+		}
+
+		err = fn(context.WithValue(ctx, attemptKey{}, attempt))
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || attempt >= policy.MaxAttempts {
+			return err
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+
+		wait := policy.backoff(attempt)
+		if left, ok := Remaining(ctx); ok && left-wait < policy.MinRemaining {
+			return retryDeadline(err)
+		}
+
+		timer := clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %w", context.Cause(ctx), err)
+		}
+	}
+}
+
+// retryDeadline wraps the last error, if any, in ErrRetryDeadline.
+func retryDeadline(err error) error {
+	if err == nil {
+		return ErrRetryDeadline
+	}
+	return fmt.Errorf("%w: %w", ErrRetryDeadline, err)
+}
+
+// withDefaults fills the zero fields of the policy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultMaxDelay
+	}
+	return p
+}
+
+// backoff returns the jittered wait after the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := attempt - 1; shift < 62 && p.BaseDelay <= p.MaxDelay>>shift {
+		ceiling = p.BaseDelay << shift
+	}
+	return time.Duration(randomUint64() % uint64(ceiling+1))
+}
@@ -0,0 +1,163 @@
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T)
+		description string
+	}{
+		{
+			name: "succeeds after retries",
+			verify: func(t *testing.T) {
+				var attempts []int
+				err := Retry(context.Background(), func(ctx context.Context) error {
+					attempts = append(attempts, Attempt(ctx))
+					if len(attempts) < 3 {
+						return errTransient
+					}
+					return nil
+				}, RetryPolicy{MaxAttempts: 5})
+
+				assert.NoError(t, err)
+				assert.Equal(t, []int{1, 2, 3}, attempts, "Attempt should number the calls")
+			},
+			description: "Retry should stop at the first success",
+		},
+		{
+			name: "attempts run out",
+			verify: func(t *testing.T) {
+				var calls int
+				start := time.Now()
+				err := Retry(context.Background(), func(context.Context) error {
+					calls++
+					return errTransient
+				}, RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 3 * time.Second})
+
+				assert.ErrorIs(t, err, errTransient, "Last error should be returned")
+				assert.Equal(t, 4, calls)
+				assert.LessOrEqual(t, time.Since(start), 6*time.Second, "Waits should be capped: 1s + 2s + 3s at most")
+			},
+			description: "Retry should give up after MaxAttempts",
+		},
+		{
+			name: "not retryable",
+			verify: func(t *testing.T) {
+				var calls int
+				err := Retry(context.Background(), func(context.Context) error {
+					calls++
+					return errFatal
+				}, RetryPolicy{Retryable: func(err error) bool { return !errors.Is(err, errFatal) }})
+
+				assert.ErrorIs(t, err, errFatal)
+				assert.Equal(t, 1, calls)
+			},
+			description: "Retry should not retry errors classified as permanent",
+		},
+		{
+			name: "not enough time for the first attempt",
+			verify: func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				var calls int
+				err := Retry(ctx, func(context.Context) error {
+					calls++
+					return nil
+				}, RetryPolicy{MinRemaining: 2 * time.Second})
+
+				assert.ErrorIs(t, err, ErrRetryDeadline)
+				assert.Zero(t, calls, "No attempt should start")
+			},
+			description: "Retry should not start an attempt without enough time left",
+		},
+		{
+			name: "not enough time for another attempt",
+			verify: func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				var calls int
+				start := time.Now()
+				err := Retry(ctx, func(context.Context) error {
+					calls++
+					time.Sleep(200 * time.Millisecond)
+					return errTransient
+				}, RetryPolicy{MaxAttempts: 10, MinRemaining: 900 * time.Millisecond})
+
+				assert.ErrorIs(t, err, ErrRetryDeadline)
+				assert.ErrorIs(t, err, errTransient, "Last error should be wrapped")
+				assert.Equal(t, 1, calls)
+				assert.Equal(t, 200*time.Millisecond, time.Since(start), "Retry should not wait in vain")
+			},
+			description: "Retry should give up early when the deadline is too close",
+		},
+		{
+			name: "context done while waiting",
+			verify: func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(time.Second, cancel)
+
+				err := Retry(ctx, func(context.Context) error {
+					return errTransient
+				}, RetryPolicy{MaxAttempts: 100, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+				assert.ErrorIs(t, err, context.Canceled)
+				assert.ErrorIs(t, err, errTransient, "Last error should be wrapped")
+			},
+			description: "Retry should stop waiting once the context is done",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Run(func() {
+				tc.verify(t)
+			})
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}.withDefaults()
+
+	testCases := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{attempt: 1, ceiling: 100 * time.Millisecond},
+		{attempt: 2, ceiling: 200 * time.Millisecond},
+		{attempt: 4, ceiling: 800 * time.Millisecond},
+		{attempt: 5, ceiling: time.Second},
+		{attempt: 100, ceiling: time.Second},
+	}
+
+	for _, tc := range testCases {
+		var longest time.Duration
+		for range 1000 {
+			wait := policy.backoff(tc.attempt)
+			assert.GreaterOrEqual(t, wait, time.Duration(0))
+			assert.LessOrEqual(t, wait, tc.ceiling, "Wait after attempt %d should be capped", tc.attempt)
+			longest = max(longest, wait)
+		}
+		assert.Greater(t, longest, tc.ceiling/2, "Full jitter should spread waits up to the ceiling")
+	}
+}
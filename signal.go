@@ -0,0 +1,69 @@
+package ctxutil
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// SignalError is the cancellation cause of a context created by OnSignals
+// once one of its signals arrives. It wraps context.Canceled.
+type SignalError struct {
+	Signal os.Signal
+}
+
+func (e *SignalError) Error() string {
+	return "ctxutil: received signal " + e.Signal.String()
+}
+
+// Unwrap returns context.Canceled.
+func (e *SignalError) Unwrap() error { return context.Canceled }
+
+// OnSignals derives a context that is canceled when one of sigs arrives,
+// with a *SignalError reporting the signal as its cause. Unlike
+// signal.NotifyContext, it keeps the values of ctx, so shutdown logs still
+// carry the trace IDs.
+// It stops listening after the first signal, restoring the default
+// behavior for the next one.
+func OnSignals(ctx context.Context, sigs ...os.Signal) (context.Context, context.CancelFunc) {
+	return OnSignalsWith(ctx, nil, sigs...)
+}
+
+// OnSignalsWith is like OnSignals, but keeps listening after the first
+// signal and calls hardExit if a second one arrives, typically to exit
+// right away instead of waiting for a graceful shutdown.
+// A nil hardExit behaves like OnSignals.
+func OnSignalsWith(ctx context.Context, hardExit func(os.Signal), sigs ...os.Signal) (context.Context, context.CancelFunc) {
+	sigCtx, cancel := context.WithCancelCause(ctx)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	stopped := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer signal.Stop(ch)
+
+		select {
+		case sig := <-ch:
+			cancel(&SignalError{Signal: sig})
+		case <-sigCtx.Done():
+			return
+		}
+
+		if hardExit == nil {
+			return
+		}
+		select {
+		case sig := <-ch:
+			hardExit(sig)
+		case <-stopped:
+		}
+	}()
+
+	return sigCtx, track("OnSignals", func() {
+		cancel(context.Canceled)
+		once.Do(func() { close(stopped) })
+	})
+}
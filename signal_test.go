@@ -0,0 +1,95 @@
+package ctxutil
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// raise sends sig to the test process.
+func raise(t *testing.T, sig os.Signal) {
+	t.Helper()
+
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	if err := p.Signal(sig); err != nil {
+		t.Skipf("cannot send %s on this platform: %v", sig, err)
+	}
+}
+
+// not parallel: signals are delivered to the whole process
+func TestOnSignals(t *testing.T) {
+	testCases := []struct {
+		name        string
+		verify      func(*testing.T, context.Context)
+		description string
+	}{
+		{
+			name: "signal cancels with cause",
+			verify: func(t *testing.T, ctx context.Context) {
+				sigCtx, cancel := OnSignals(ctx, os.Interrupt)
+				defer cancel()
+
+				assert.NoError(t, sigCtx.Err())
+
+				raise(t, os.Interrupt)
+				select {
+				case <-sigCtx.Done():
+				case <-time.After(5 * time.Second):
+					t.Fatal("signal did not cancel the context")
+				}
+
+				assert.ErrorIs(t, sigCtx.Err(), context.Canceled)
+
+				var sigErr *SignalError
+				require.ErrorAs(t, context.Cause(sigCtx), &sigErr)
+				assert.Equal(t, os.Interrupt, sigErr.Signal)
+				assert.ErrorIs(t, sigErr, context.Canceled, "SignalError should wrap Canceled")
+				assert.Equal(t, "trace-signal", GetTraceID(sigCtx), "Values should be preserved")
+			},
+			description: "A signal should cancel the context with a SignalError",
+		},
+		{
+			name: "second signal runs hard exit hook",
+			verify: func(t *testing.T, ctx context.Context) {
+				exits := make(chan os.Signal, 1)
+				sigCtx, cancel := OnSignalsWith(ctx, func(sig os.Signal) { exits <- sig }, os.Interrupt)
+				defer cancel()
+
+				raise(t, os.Interrupt)
+				<-sigCtx.Done()
+				assert.Empty(t, exits, "First signal should only cancel")
+
+				raise(t, os.Interrupt)
+				select {
+				case sig := <-exits:
+					assert.Equal(t, os.Interrupt, sig)
+				case <-time.After(5 * time.Second):
+					t.Fatal("second signal did not run the hard exit hook")
+				}
+			},
+			description: "The hard exit hook should run on the second signal",
+		},
+		{
+			name: "cancel",
+			verify: func(t *testing.T, ctx context.Context) {
+				sigCtx, cancel := OnSignals(ctx, os.Interrupt)
+				cancel()
+
+				assert.ErrorIs(t, sigCtx.Err(), context.Canceled)
+				assert.ErrorIs(t, context.Cause(sigCtx), context.Canceled)
+			},
+			description: "Cancel should end the context without a signal",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.verify(t, SetTraceID(context.Background(), "trace-signal"))
+		})
+	}
+}